@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	"backend/models"
@@ -12,42 +14,47 @@ import (
 	"backend/websocket"
 
 	"github.com/gorilla/mux"
-	gorillaws "github.com/gorilla/websocket"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Agent struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name      string             `bson:"name" json:"name"`
-	Email     string             `bson:"email" json:"email"`
-	Password  string             `bson:"password,omitempty" json:"-"`
-	Status    string             `bson:"status" json:"status"`
-	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
-}
-
-type AgentStatusUpdate struct {
-	AgentID string `json:"agentId"`
-	Status  string `json:"status"`
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name           string             `bson:"name" json:"name"`
+	Email          string             `bson:"email" json:"email"`
+	Password       string             `bson:"password,omitempty" json:"-"`
+	Status         string             `bson:"status" json:"status"`
+	Role           string             `bson:"role,omitempty" json:"role"`
+	Presence       string             `bson:"presence,omitempty" json:"presence"`
+	LastSeen       time.Time          `bson:"lastSeen,omitempty" json:"lastSeen"`
+	MaxConcurrent  int                `bson:"maxConcurrent,omitempty" json:"maxConcurrent"`
+	ActiveSessions int                `bson:"activeSessions,omitempty" json:"activeSessions"`
+	Skills         []string           `bson:"skills,omitempty" json:"skills"`
+	Languages      []string           `bson:"languages,omitempty" json:"languages"`
+	CreatedAt      time.Time          `bson:"createdAt" json:"createdAt"`
 }
 
 func AgentStatusHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST,OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	type requestBody struct {
-		AgentID string `json:"agentId"`
-		Status  string `json:"status"`
+		Status string `json:"status"`
 	}
 
 	var req requestBody
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil ||
-		req.AgentID == "" || req.Status == "" {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Status == "" {
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
@@ -55,29 +62,37 @@ func AgentStatusHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	agentID, err := primitive.ObjectIDFromHex(req.AgentID)
+	agentID, err := primitive.ObjectIDFromHex(principal.ID)
 	if err != nil {
 		http.Error(w, "Invalid agent ID", http.StatusBadRequest)
 		return
 	}
 
-	filter := bson.M{"_id": agentID}
-	update := bson.M{"$set": bson.M{"status": req.Status}}
-
-	_, err = utils.AgentColl.UpdateOne(ctx, filter, update)
+	// available and busy both mean "working"; which of the two applies
+	// depends on the agent's load.
+	if req.Status == "available" || req.Status == "busy" {
+		_, err = utils.MarkAgentWorking(ctx, agentID)
+	} else {
+		_, err = utils.AgentColl.UpdateOne(ctx, bson.M{"_id": agentID}, bson.M{"$set": bson.M{"status": req.Status}})
+	}
 	if err != nil {
 		http.Error(w, "Failed to update agent status", http.StatusInternalServerError)
 		return
 	}
+	if req.Status == "available" || req.Status == "busy" {
+		websocket.RequestDispatch()
+	}
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Agent status updated"))
 }
 
+// AgentRegisterHandler creates a staff account with the agent role. Only
+// admins get here; the first admin comes from SeedBootstrapAdmin.
 func AgentRegisterHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST,OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
@@ -87,6 +102,11 @@ func AgentRegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	var input struct {
 		Name     string `json:"name"`
 		Email    string `json:"email"`
@@ -96,6 +116,11 @@ func AgentRegisterHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Geçersiz JSON", http.StatusBadRequest)
 		return
 	}
+	input.Email = strings.TrimSpace(input.Email)
+	if input.Email == "" || input.Password == "" {
+		http.Error(w, "E-posta ve şifre zorunludur", http.StatusBadRequest)
+		return
+	}
 
 	coll := utils.MongoDB.Collection("agents")
 
@@ -106,7 +131,7 @@ func AgentRegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashed, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	hashed, err := utils.HashPassword(input.Password)
 	if err != nil {
 		http.Error(w, "Sunucu hatası", http.StatusInternalServerError)
 		return
@@ -115,7 +140,8 @@ func AgentRegisterHandler(w http.ResponseWriter, r *http.Request) {
 	newAgent := Agent{
 		Name:      input.Name,
 		Email:     input.Email,
-		Password:  string(hashed),
+		Password:  hashed,
+		Role:      utils.RoleAgent,
 		CreatedAt: time.Now(),
 	}
 	res, err := coll.InsertOne(ctx, newAgent)
@@ -123,6 +149,7 @@ func AgentRegisterHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Kayıt sırasında hata", http.StatusInternalServerError)
 		return
 	}
+	log.Printf("[ADMIN] %s registered agent %s", principal.ID, input.Email)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -134,7 +161,7 @@ func AgentRegisterHandler(w http.ResponseWriter, r *http.Request) {
 func AgentLoginHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST,OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
@@ -170,25 +197,39 @@ func AgentLoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	update := bson.M{"$set": bson.M{"status": "available"}}
-	_, err := coll.UpdateOne(ctx, bson.M{"_id": agent.ID}, update)
+	_, err := utils.MarkAgentWorking(ctx, agent.ID)
 	if err != nil {
 		log.Println("[AGENT LOGIN][ERROR] Status güncellenemedi:", err)
 	} else {
 		log.Println("[AGENT LOGIN][OK] Agent", agent.ID.Hex(), "status set to available (login sonrası)")
+		websocket.RequestDispatch()
+	}
+
+	tokens, err := utils.IssueTokens(utils.Principal{
+		ID:    agent.ID.Hex(),
+		Email: agent.Email,
+		Role:  utils.StaffRole(agent.Role),
+	})
+	if err != nil {
+		http.Error(w, "Sunucu hatası", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Agent girişi başarılı",
-		"agentId": agent.ID.Hex(),
+		"message":      "Agent girişi başarılı",
+		"agentId":      agent.ID.Hex(),
+		"accessToken":  tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
+		"tokenType":    tokens.TokenType,
+		"expiresIn":    tokens.ExpiresIn,
 	})
 }
 
 func TakeOverAISessionHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST,OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
@@ -197,167 +238,73 @@ func TakeOverAISessionHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	var body struct {
-		AgentID   string `json:"agentId"`
 		SessionID string `json:"sessionId"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.AgentID == "" {
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	agentID := principal.ID
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	agentObjId, err := primitive.ObjectIDFromHex(body.AgentID)
+	agentObjId, err := primitive.ObjectIDFromHex(agentID)
 	if err != nil {
 		http.Error(w, "Invalid agent ID", http.StatusBadRequest)
 		return
 	}
 
-	var agent models.Agent
-	err = utils.AgentColl.FindOne(ctx, bson.M{"_id": agentObjId, "status": "available"}).Decode(&agent)
-	if err != nil {
+	claimed, err := utils.ClaimAgent(ctx, agentObjId)
+	if err != nil || !claimed {
 		http.Error(w, "Agent not available", http.StatusBadRequest)
 		return
 	}
 
 	var session models.Session
+	var taken bool
 
 	if body.SessionID != "" {
 		sessionObjID, err := primitive.ObjectIDFromHex(body.SessionID)
 		if err != nil {
+			utils.ReleaseAgent(ctx, agentObjId)
 			http.Error(w, "Invalid session ID", http.StatusBadRequest)
 			return
 		}
-
-		err = utils.SessionColl.FindOne(ctx, bson.M{
-			"_id":    sessionObjID,
-			"mode":   "system",
-			"status": "active",
-		}).Decode(&session)
-
-		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"message":   "Specified session not found or not available",
-				"available": false,
-			})
+		session, taken, err = utils.ClaimSession(ctx, sessionObjID, agentID, agentID, "takeover", utils.StateQueued, utils.StateAI)
+		if err == nil && !taken {
+			utils.ReleaseAgent(ctx, agentObjId)
+			sessionConflict(ctx, w, sessionObjID)
 			return
 		}
 	} else {
-
-		err = utils.SessionColl.FindOne(ctx, bson.M{
-			"mode":   "system",
-			"status": "active",
-		}).Decode(&session)
-
-		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"message":   "No system sessions available to take over",
-				"available": false,
-			})
-			return
-		}
+		session, taken, err = claimNextSession(ctx, agentID)
 	}
-
-	updateResult, err := utils.SessionColl.UpdateOne(ctx,
-		bson.M{"_id": session.ID},
-		bson.M{"$set": bson.M{
-			"assignedAgent": body.AgentID,
-			"mode":          "human",
-			"status":        "active",
-			"lastActivity":  time.Now(),
-		}},
-	)
 	if err != nil {
+		utils.ReleaseAgent(ctx, agentObjId)
 		log.Printf("[TAKEOVER][ERROR] Failed to update session: %v", err)
 		http.Error(w, "Failed to transfer session", http.StatusInternalServerError)
 		return
 	}
-	log.Printf("[TAKEOVER][SUCCESS] Session updated - matched: %d, modified: %d", updateResult.MatchedCount, updateResult.ModifiedCount)
-
-	var updatedSession models.Session
-	err = utils.SessionColl.FindOne(ctx, bson.M{"_id": session.ID}).Decode(&updatedSession)
-	if err != nil {
-		log.Printf("[TAKEOVER][ERROR] Failed to verify session update: %v", err)
-	} else {
-		log.Printf("[TAKEOVER][VERIFY] Session mode is now: %s, agent: %s", updatedSession.Mode, updatedSession.AssignedAgent)
-	}
-
-	_, err = utils.AgentColl.UpdateOne(ctx,
-		bson.M{"_id": agentObjId},
-		bson.M{"$set": bson.M{"status": "busy"}},
-	)
-	if err != nil {
-		log.Printf("[TAKEOVER][ERROR] Agent status 'busy' yapılamadı: %v\n", err)
-	}
-
-	sessionUpdate := map[string]interface{}{
-		"sessionId":     session.ID.Hex(),
-		"userId":        session.UserID,
-		"assignedAgent": body.AgentID,
-		"mode":          "human",
-		"status":        "active",
-		"lastActivity":  time.Now(),
-		"action":        "takeover",
-	}
-	websocket.BroadcastSessionUpdate(sessionUpdate)
-
-	userConn := websocket.GetUserConn(session.UserID)
-	if userConn != nil {
-		userNotification := map[string]interface{}{
-			"sender":        "system",
-			"mode":          "human",
-			"status":        "active",
-			"assignedAgent": body.AgentID,
-		}
-		jsonData, _ := json.Marshal(userNotification)
-		userConn.WriteMessage(gorillaws.TextMessage, jsonData)
-		log.Printf("[TAKEOVER] Notified user %s about agent takeover", session.UserID)
-	}
-
-	agentConn := websocket.GetAgentConn(body.AgentID)
-	if agentConn != nil {
-		messageCursor, err := utils.MessageColl.Find(ctx, bson.M{"sessionId": session.ID})
-		if err == nil {
-			defer messageCursor.Close(ctx)
-			for messageCursor.Next(ctx) {
-				var msg models.Message
-				if err := messageCursor.Decode(&msg); err == nil {
-					out := map[string]interface{}{
-						"sender":  msg.Sender,
-						"message": msg.Text,
-						"type":    "history",
-					}
-					jsonData, _ := json.Marshal(out)
-					agentConn.WriteMessage(gorillaws.TextMessage, jsonData)
-				}
-			}
-			log.Printf("[WS] Sent message history to agent %s for session %s", body.AgentID, session.ID.Hex())
-		}
-	}
-
-	var messages []models.Message
-	messageCursor, err := utils.MessageColl.Find(ctx, bson.M{"sessionId": session.ID})
-	if err == nil {
-		defer messageCursor.Close(ctx)
-		for messageCursor.Next(ctx) {
-			var msg models.Message
-			if err := messageCursor.Decode(&msg); err == nil {
-				messages = append(messages, msg)
-			}
-		}
+	if !taken {
+		utils.ReleaseAgent(ctx, agentObjId)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":   "No system sessions available to take over",
+			"available": false,
+		})
+		return
 	}
+	log.Printf("[TAKEOVER][SUCCESS] Session %s taken over by agent %s", session.ID.Hex(), agentID)
 
-	for i := 0; i < len(messages)-1; i++ {
-		for j := i + 1; j < len(messages); j++ {
-			if messages[i].Timestamp.After(messages[j].Timestamp) {
-				messages[i], messages[j] = messages[j], messages[i]
-			}
-		}
-	}
+	messages := websocket.AnnounceAssignment(session, agentID, "takeover")
+	log.Printf("[WS] Sent message history to agent %s for session %s", agentID, session.ID.Hex())
 
 	var user struct {
 		ID    primitive.ObjectID `bson:"_id,omitempty"`
@@ -382,7 +329,7 @@ func TakeOverAISessionHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message":   "Successfully took over system session",
 		"sessionId": session.ID.Hex(),
-		"agentId":   body.AgentID,
+		"agentId":   agentID,
 		"available": true,
 		"messages":  formattedMessages,
 		"userInfo": map[string]interface{}{
@@ -392,10 +339,53 @@ func TakeOverAISessionHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// claimNextSession takes the longest-waiting queued session that best fits
+// the agent's skills and languages, or failing that an AI session that
+// nobody asked to escalate. Sessions claimed by someone else in the meantime
+// are skipped.
+func claimNextSession(ctx context.Context, agentID string) (models.Session, bool, error) {
+	queued, err := utils.QueuedSessions(ctx)
+	if err != nil {
+		return models.Session{}, false, err
+	}
+	agentObjId, _ := primitive.ObjectIDFromHex(agentID)
+	var agent models.Agent
+	if err := utils.AgentColl.FindOne(ctx, bson.M{"_id": agentObjId}).Decode(&agent); err == nil {
+		sort.SliceStable(queued, func(i, j int) bool {
+			return utils.MatchScore(agent, queued[i]) > utils.MatchScore(agent, queued[j])
+		})
+	}
+	for _, s := range queued {
+		session, ok, err := utils.ClaimSession(ctx, s.ID, agentID, agentID, "takeover", utils.StateQueued)
+		if err != nil || ok {
+			return session, ok, err
+		}
+	}
+
+	cursor, err := utils.SessionColl.Find(ctx,
+		bson.M{"mode": utils.ModeSystem, "status": utils.StatusActive},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}).SetLimit(20),
+	)
+	if err != nil {
+		return models.Session{}, false, err
+	}
+	var candidates []models.Session
+	if err := cursor.All(ctx, &candidates); err != nil {
+		return models.Session{}, false, err
+	}
+	for _, s := range candidates {
+		session, ok, err := utils.ClaimSession(ctx, s.ID, agentID, agentID, "takeover", utils.StateAI)
+		if err != nil || ok {
+			return session, ok, err
+		}
+	}
+	return models.Session{}, false, nil
+}
+
 func AssignSessionToAgentHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST,OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
@@ -405,19 +395,24 @@ func AssignSessionToAgentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	var body struct {
-		AgentID   string `json:"agentId"`
 		SessionID string `json:"sessionId"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.AgentID == "" || body.SessionID == "" {
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.SessionID == "" {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	agentID := principal.ID
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	agentObjId, err := primitive.ObjectIDFromHex(body.AgentID)
+	agentObjId, err := primitive.ObjectIDFromHex(agentID)
 	if err != nil {
 		http.Error(w, "Invalid agent ID", http.StatusBadRequest)
 		return
@@ -429,60 +424,41 @@ func AssignSessionToAgentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var agent models.Agent
-	err = utils.AgentColl.FindOne(ctx, bson.M{"_id": agentObjId, "status": "available"}).Decode(&agent)
-	if err != nil {
-		http.Error(w, "Agent not available", http.StatusBadRequest)
-		return
-	}
-
 	var session models.Session
-	err = utils.SessionColl.FindOne(ctx, bson.M{"_id": sessionObjId, "status": "active"}).Decode(&session)
+	err = utils.SessionColl.FindOne(ctx, bson.M{"_id": sessionObjId}).Decode(&session)
 	if err != nil {
-		http.Error(w, "Session not found or not active", http.StatusBadRequest)
+		http.Error(w, "Session not found", http.StatusNotFound)
 		return
 	}
 
-	_, err = utils.SessionColl.UpdateOne(ctx,
-		bson.M{"_id": sessionObjId},
-		bson.M{"$set": bson.M{
-			"assignedAgent": body.AgentID,
-			"mode":          "human",
-			"status":        "active",
-			"lastActivity":  time.Now(),
-		}},
-	)
-	if err != nil {
-		http.Error(w, "Failed to assign session", http.StatusInternalServerError)
-		return
-	}
-
-	_, err = utils.AgentColl.UpdateOne(ctx,
-		bson.M{"_id": agentObjId},
-		bson.M{"$set": bson.M{"status": "busy"}},
-	)
-	if err != nil {
-		log.Printf("[ASSIGN][ERROR] Agent status 'busy' yapılamadı: %v\n", err)
-	}
-
 	var messages []models.Message
-	messageCursor, err := utils.MessageColl.Find(ctx, bson.M{"sessionId": sessionObjId})
-	if err == nil {
-		defer messageCursor.Close(ctx)
-		for messageCursor.Next(ctx) {
-			var msg models.Message
-			if err := messageCursor.Decode(&msg); err == nil {
-				messages = append(messages, msg)
-			}
+	if utils.SessionState(session) == utils.StateAgent && session.AssignedAgent == agentID {
+		// Re-opening a session the agent already owns takes no new slot.
+		messages, err = utils.FindSessionMessages(ctx, sessionObjId, 0)
+		if err != nil {
+			log.Printf("[WS][ERROR] Failed to load history for session %s: %v", sessionObjId.Hex(), err)
 		}
-	}
-
-	for i := 0; i < len(messages)-1; i++ {
-		for j := i + 1; j < len(messages); j++ {
-			if messages[i].Timestamp.After(messages[j].Timestamp) {
-				messages[i], messages[j] = messages[j], messages[i]
-			}
+		websocket.SendHistory(agentID, messages)
+	} else {
+		claimed, err := utils.ClaimAgent(ctx, agentObjId)
+		if err != nil || !claimed {
+			http.Error(w, "Agent not available", http.StatusBadRequest)
+			return
+		}
+		// Like the dispatcher, only a session still with the assistant or in
+		// the queue can be claimed; anything else is a 409.
+		claimedSession, taken, err := utils.ClaimSession(ctx, sessionObjId, agentID, agentID, "assign", utils.StateAI, utils.StateQueued)
+		if err != nil {
+			utils.ReleaseAgent(ctx, agentObjId)
+			http.Error(w, "Failed to assign session", http.StatusInternalServerError)
+			return
+		}
+		if !taken {
+			utils.ReleaseAgent(ctx, agentObjId)
+			sessionConflict(ctx, w, sessionObjId)
+			return
 		}
+		messages = websocket.AnnounceAssignment(claimedSession, agentID, "takeover")
 	}
 
 	var user struct {
@@ -492,20 +468,7 @@ func AssignSessionToAgentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	utils.MongoDB.Collection("users").FindOne(ctx, bson.M{"email": session.UserID}).Decode(&user)
-
-	agentConn := websocket.GetAgentConn(body.AgentID)
-	if agentConn != nil {
-		for _, msg := range messages {
-			out := map[string]interface{}{
-				"sender":  msg.Sender,
-				"message": msg.Text,
-				"type":    "history",
-			}
-			jsonData, _ := json.Marshal(out)
-			agentConn.WriteMessage(gorillaws.TextMessage, jsonData)
-		}
-		log.Printf("[WS] Sent message history to agent %s for session %s", body.AgentID, body.SessionID)
-	}
+	log.Printf("[WS] Sent message history to agent %s for session %s", agentID, body.SessionID)
 
 	var formattedMessages []map[string]interface{}
 	for _, msg := range messages {
@@ -522,7 +485,7 @@ func AssignSessionToAgentHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message":   "Successfully assigned session to agent",
 		"sessionId": body.SessionID,
-		"agentId":   body.AgentID,
+		"agentId":   agentID,
 		"success":   true,
 		"messages":  formattedMessages,
 		"userInfo": map[string]interface{}{
@@ -535,19 +498,26 @@ func AssignSessionToAgentHandler(w http.ResponseWriter, r *http.Request) {
 func GetAgentActiveSessionsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET,OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	agentId := vars["agentId"]
+	if agentId != principal.ID && !utils.HasPermission(principal.Role, utils.PermAgentViewAll) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
 
 	log.Printf("[AGENT] Getting active sessions for agent: %s", agentId)
 
-	CleanupOldSessions()
-
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -614,7 +584,7 @@ func GetAgentActiveSessionsHandler(w http.ResponseWriter, r *http.Request) {
 func GetAISessionsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET,OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
@@ -625,7 +595,7 @@ func GetAISessionsHandler(w http.ResponseWriter, r *http.Request) {
 
 	cursor, err := utils.SessionColl.Find(ctx, bson.M{
 		"mode":   "system",
-		"status": "active",
+		"status": bson.M{"$in": []string{"active", "waiting_for_agent"}},
 	})
 	if err != nil {
 		http.Error(w, "Failed to fetch system sessions", http.StatusInternalServerError)
@@ -657,6 +627,17 @@ func GetAISessionsHandler(w http.ResponseWriter, r *http.Request) {
 				"userId":       s.UserID,
 				"createdAt":    s.CreatedAt,
 				"lastActivity": s.LastActivity,
+				"status":       s.Status,
+			}
+			if s.RequiredSkill != "" {
+				sessionData["requiredSkill"] = s.RequiredSkill
+			}
+			if s.Language != "" {
+				sessionData["language"] = s.Language
+			}
+			if s.EscalationReason != "" {
+				sessionData["escalationReason"] = s.EscalationReason
+				sessionData["escalatedAt"] = s.EscalatedAt
 			}
 
 			if err == nil {
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RefreshToken == "" {
+		http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+
+	principal, err := utils.ParseToken(body.RefreshToken, utils.TokenTypeRefresh)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid or expired refresh token"}`, http.StatusUnauthorized)
+		return
+	}
+
+	objID, err := primitive.ObjectIDFromHex(principal.ID)
+	if err != nil {
+		http.Error(w, `{"error": "Invalid or expired refresh token"}`, http.StatusUnauthorized)
+		return
+	}
+
+	collection := utils.MongoDB.Collection("users")
+	if utils.IsStaffRole(principal.Role) {
+		collection = utils.AgentColl
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var account struct {
+		Email    string    `bson:"email"`
+		Role     string    `bson:"role"`
+		ErasedAt time.Time `bson:"erasedAt"`
+	}
+	if err := collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&account); err != nil {
+		http.Error(w, `{"error": "Account not found"}`, http.StatusUnauthorized)
+		return
+	}
+	// An erased account keeps its _id, so its old refresh tokens must not
+	// bring it back.
+	if !account.ErasedAt.IsZero() {
+		http.Error(w, `{"error": "Account not found"}`, http.StatusUnauthorized)
+		return
+	}
+	principal.Email = account.Email
+
+	if utils.IsStaffRole(principal.Role) {
+		principal.Role = utils.StaffRole(account.Role)
+	} else {
+		principal.Role = utils.CustomerRole(account.Role)
+	}
+
+	tokens, err := utils.IssueTokens(*principal)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to issue token"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
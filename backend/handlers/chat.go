@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
 	"time"
 
+	"backend/models"
 	"backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 type ChatMessage struct {
@@ -17,11 +19,6 @@ type ChatMessage struct {
 	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
 }
 
-type ChatRecord struct {
-	Conversation []ChatMessage `bson:"conversation"`
-	CreatedAt    time.Time     `bson:"createdAt"`
-}
-
 type ChatRequest struct {
 	Conversation []struct {
 		Sender string `json:"sender"`
@@ -31,7 +28,7 @@ type ChatRequest struct {
 
 func ChatHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
@@ -61,26 +58,30 @@ func ChatHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var b strings.Builder
+	var messages []utils.LLMMessage
 	for _, msg := range history {
 		switch msg.Sender {
 		case "user":
-			b.WriteString("User: " + msg.Text + "\n")
-		case "agent":
-			b.WriteString("Support: " + msg.Text + "\n")
-		case "ai":
-			b.WriteString("Assistant: " + msg.Text + "\n")
+			messages = append(messages, utils.LLMMessage{Role: utils.LLMRoleUser, Text: redacted(msg.Text)})
+		case "agent", "ai", "system":
+			messages = append(messages, utils.LLMMessage{Role: utils.LLMRoleAssistant, Text: redacted(msg.Text)})
 		}
 	}
-	b.WriteString("Assistant:")
 
-	prompt := b.String()
+	var email string
+	if principal, ok := utils.PrincipalFromContext(r.Context()); ok {
+		email = principal.Email
+	}
 
-	aiReply, err := utils.AskGemini(prompt)
+	resp, err := utils.LLM.Complete(r.Context(), utils.LLMRequest{
+		System:   utils.SystemPrompt(r.Context(), utils.DefaultTenant, "api", email, nil),
+		Messages: messages,
+	})
 	if err != nil {
 		http.Error(w, "AI Error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	aiReply := resp.Text
 
 	history = append(history, ChatMessage{
 		Sender:    "system",
@@ -88,16 +89,19 @@ func ChatHandler(w http.ResponseWriter, r *http.Request) {
 		Timestamp: time.Now(),
 	})
 
-	record := ChatRecord{
-		Conversation: history,
-		CreatedAt:    time.Now(),
+	entries := make([]models.ConversationEntry, 0, len(history))
+	for _, msg := range history {
+		entries = append(entries, models.ConversationEntry{Sender: msg.Sender, Text: msg.Text, Timestamp: msg.Timestamp})
+	}
+	record := bson.M{"createdAt": time.Now()}
+	if email != "" {
+		record["userId"] = email
 	}
 	fmt.Println("[3] MongoDB InsertOne başlıyor")
-	coll := utils.MongoDB.Collection("messages")
-	if res, err := coll.InsertOne(context.Background(), record); err != nil {
+	if id, err := utils.InsertConversation(context.Background(), record, "conversation", entries); err != nil {
 		fmt.Println(" MongoDB error:", err)
 	} else {
-		fmt.Println("Konuşma kaydedildi:", res.InsertedID)
+		fmt.Println("Konuşma kaydedildi:", id.Hex())
 	}
 
 	w.Header().Set("Content-Type", "application/json")
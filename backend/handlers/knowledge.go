@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxArticleSize = 5 << 20
+
+var articleFormats = map[string]string{
+	".md":       utils.KBFormatMarkdown,
+	".markdown": utils.KBFormatMarkdown,
+	".html":     utils.KBFormatHTML,
+	".htm":      utils.KBFormatHTML,
+	".txt":      utils.KBFormatText,
+}
+
+// CreateArticleHandler accepts either a JSON body with title, format, content
+// and tags, or a multipart form with a file whose extension gives the format.
+func CreateArticleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxArticleSize)
+
+	var article models.KBArticle
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "file is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		ext := strings.ToLower(filepath.Ext(header.Filename))
+		format, ok := articleFormats[ext]
+		if !ok {
+			http.Error(w, "Unsupported file type "+ext+"; upload .md, .html or .txt (text extracted from PDFs)", http.StatusBadRequest)
+			return
+		}
+		content, err := io.ReadAll(file)
+		if err != nil {
+			http.Error(w, "Failed to read file", http.StatusBadRequest)
+			return
+		}
+
+		article.Title = r.FormValue("title")
+		if article.Title == "" {
+			article.Title = strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+		}
+		article.Format = format
+		article.Source = string(content)
+		if tags := r.FormValue("tags"); tags != "" {
+			article.Tags = strings.Split(tags, ",")
+		}
+	} else {
+		var body struct {
+			Title   string   `json:"title"`
+			Format  string   `json:"format"`
+			Content string   `json:"content"`
+			Tags    []string `json:"tags"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		article.Title = body.Title
+		article.Format = strings.ToLower(body.Format)
+		article.Source = body.Content
+		article.Tags = body.Tags
+	}
+
+	article.Title = strings.TrimSpace(article.Title)
+	if article.Title == "" || strings.TrimSpace(article.Source) == "" {
+		http.Error(w, "title and content are required", http.StatusBadRequest)
+		return
+	}
+	if article.Format == "" {
+		article.Format = utils.KBFormatText
+	}
+	for i := range article.Tags {
+		article.Tags[i] = strings.TrimSpace(article.Tags[i])
+	}
+	if !utils.IsKBFormat(article.Format) {
+		http.Error(w, "format must be markdown, html or text", http.StatusBadRequest)
+		return
+	}
+
+	article.CreatedBy = principal.ID
+	article.CreatedAt = time.Now()
+	article.UpdatedAt = article.CreatedAt
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	res, err := utils.KBArticleColl().InsertOne(ctx, article)
+	if err != nil {
+		http.Error(w, "Failed to save article", http.StatusInternalServerError)
+		return
+	}
+	article.ID = res.InsertedID.(primitive.ObjectID)
+
+	if err := utils.IndexArticle(ctx, &article); err != nil {
+		log.Printf("[KB][ERROR] Failed to index article %s: %v", article.ID.Hex(), err)
+		utils.DeleteArticle(ctx, article.ID)
+		http.Error(w, "Failed to index article: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[KB] %s added article %s (%d chunks)", principal.ID, article.ID.Hex(), article.ChunkCount)
+
+	article.Source = ""
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(article)
+}
+
+func ListArticlesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		filter["tags"] = tag
+	}
+
+	cursor, err := utils.KBArticleColl().Find(ctx, filter,
+		options.Find().SetProjection(bson.M{"source": 0}).SetSort(bson.D{{Key: "updatedAt", Value: -1}}))
+	if err != nil {
+		http.Error(w, "Failed to fetch articles", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	articles := []models.KBArticle{}
+	if err := cursor.All(ctx, &articles); err != nil {
+		http.Error(w, "Failed to fetch articles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"articles": articles})
+}
+
+func GetArticleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	articleObjId, err := primitive.ObjectIDFromHex(mux.Vars(r)["articleId"])
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var article models.KBArticle
+	if err := utils.KBArticleColl().FindOne(ctx, bson.M{"_id": articleObjId}).Decode(&article); err != nil {
+		http.Error(w, "Article not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(article)
+}
+
+func DeleteArticleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "DELETE,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	articleObjId, err := primitive.ObjectIDFromHex(mux.Vars(r)["articleId"])
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	found, err := utils.DeleteArticle(ctx, articleObjId)
+	if err != nil {
+		http.Error(w, "Failed to delete article", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Article not found", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("[KB] %s deleted article %s", principal.ID, articleObjId.Hex())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Article deleted"})
+}
+
+// ReindexArticlesHandler re-chunks and re-embeds every article, which is
+// needed after switching EMBEDDER.
+func ReindexArticlesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	cursor, err := utils.KBArticleColl().Find(ctx, bson.M{})
+	if err != nil {
+		http.Error(w, "Failed to fetch articles", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	indexed, failed := 0, []string{}
+	for cursor.Next(ctx) {
+		var article models.KBArticle
+		if err := cursor.Decode(&article); err != nil {
+			continue
+		}
+		if err := utils.IndexArticle(ctx, &article); err != nil {
+			log.Printf("[KB][ERROR] Failed to reindex article %s: %v", article.ID.Hex(), err)
+			failed = append(failed, article.ID.Hex())
+			continue
+		}
+		indexed++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"indexed":  indexed,
+		"failed":   failed,
+		"embedder": utils.Embeddings.Name(),
+	})
+}
+
+func SearchKnowledgeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	k, err := strconv.Atoi(r.URL.Query().Get("k"))
+	if err != nil || k <= 0 {
+		k = 5
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	matches, err := utils.SearchKnowledge(ctx, query, k)
+	if err != nil {
+		http.Error(w, "Search failed", http.StatusInternalServerError)
+		return
+	}
+	if matches == nil {
+		matches = []utils.KBMatch{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"matches": matches})
+}
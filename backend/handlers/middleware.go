@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"net/http"
+
+	"backend/utils"
 )
 
 func CORSMiddleware(next http.Handler) http.Handler {
@@ -17,4 +19,62 @@ func CORSMiddleware(next http.Handler) http.Handler {
 
 		next.ServeHTTP(w, r)
 	})
-}
\ No newline at end of file
+}
+
+func AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "OPTIONS" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := utils.TokenFromRequest(r)
+		if token == "" {
+			http.Error(w, `{"error": "Missing access token"}`, http.StatusUnauthorized)
+			return
+		}
+
+		principal, err := utils.ParseToken(token, utils.TokenTypeAccess)
+		if err != nil {
+			http.Error(w, `{"error": "Invalid or expired access token"}`, http.StatusUnauthorized)
+			return
+		}
+		if utils.AccountErased(r.Context(), principal) {
+			http.Error(w, `{"error": "Invalid or expired access token"}`, http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(utils.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+func currentPrincipal(w http.ResponseWriter, r *http.Request) (*utils.Principal, bool) {
+	principal, ok := utils.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return nil, false
+	}
+	return principal, true
+}
+
+func RequirePermission(perm utils.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "OPTIONS" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			principal, ok := currentPrincipal(w, r)
+			if !ok {
+				return
+			}
+			if !utils.HasPermission(principal.Role, perm) {
+				http.Error(w, `{"error": "Forbidden"}`, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// redacted masks personal data in text before it is sent to the model.
+func redacted(text string) string {
+	masked, _ := utils.RedactPII(text)
+	return masked
+}
+
+// GetOriginalMessageHandler reveals a message as it was written, personal
+// data included. Every reveal is recorded in the compliance log.
+func GetOriginalMessageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	messageObjId, err := primitive.ObjectIDFromHex(r.URL.Query().Get("messageId"))
+	if err != nil {
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msg, err := utils.OriginalMessage(ctx, messageObjId)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch message", http.StatusInternalServerError)
+		return
+	}
+
+	var session models.Session
+	err = utils.SessionColl.FindOne(ctx, bson.M{"_id": msg.SessionID}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		err = utils.SessionArchiveColl().FindOne(ctx, bson.M{"_id": msg.SessionID}).Decode(&session)
+	}
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	logCompliance(ctx, models.ComplianceRecord{
+		Type:        utils.CompliancePIIAccess,
+		SubjectHash: utils.SubjectHash(session.UserID),
+		RequestedBy: principal.ID,
+		Outcome:     utils.OutcomeCompleted,
+		Detail:      msg.ID.Hex(),
+	})
+	log.Printf("[PRIVACY] %s revealed message %s of session %s", principal.ID, msg.ID.Hex(), msg.SessionID.Hex())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":        msg.ID.Hex(),
+		"sessionId": msg.SessionID.Hex(),
+		"sender":    msg.Sender,
+		"text":      msg.Text,
+		"pii":       msg.PII,
+		"timestamp": msg.Timestamp.Format("2006-01-02T15:04:05Z07:00"),
+	})
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+	"backend/websocket"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// privacySubject works out whose data a request is about: customers may only
+// ask about themselves, admins about anyone by userId (email).
+func privacySubject(w http.ResponseWriter, principal *utils.Principal, requested string) (string, bool) {
+	if requested != "" && requested != principal.Email {
+		if !utils.HasPermission(principal.Role, utils.PermPrivacyManage) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return "", false
+		}
+		return requested, true
+	}
+	if !utils.HasPermission(principal.Role, utils.PermPrivacySelf) {
+		http.Error(w, "userId is required", http.StatusBadRequest)
+		return "", false
+	}
+	return principal.Email, true
+}
+
+func logCompliance(ctx context.Context, record models.ComplianceRecord) {
+	if err := utils.LogComplianceRequest(ctx, record); err != nil {
+		log.Printf("[PRIVACY][ERROR] Failed to log %s request: %v", record.Type, err)
+	}
+}
+
+// ExportUserDataHandler downloads everything held about a customer as JSON,
+// or as a ZIP with one file per session when format=zip.
+func ExportUserDataHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	subject, ok := privacySubject(w, principal, r.URL.Query().Get("userId"))
+	if !ok {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "zip" {
+		http.Error(w, "format must be json or zip", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	record := models.ComplianceRecord{
+		Type:        utils.ComplianceExport,
+		SubjectHash: utils.SubjectHash(subject),
+		RequestedBy: principal.ID,
+		Format:      format,
+	}
+
+	export, err := utils.CollectUserData(ctx, subject)
+	if err != nil {
+		record.Outcome, record.Detail = utils.OutcomeFailed, err.Error()
+		logCompliance(ctx, record)
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to export user data", http.StatusInternalServerError)
+		return
+	}
+	record.Outcome = utils.OutcomeCompleted
+	record.Counts = map[string]int64{
+		"sessions":      int64(len(export.Sessions)),
+		"conversations": int64(len(export.Conversations)),
+	}
+	logCompliance(ctx, record)
+	log.Printf("[PRIVACY] %s exported data of subject %s as %s", principal.ID, record.SubjectHash[:12], format)
+
+	filename := "export-" + export.ExportedAt.Format("20060102-150405")
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(export)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+	zw := zip.NewWriter(w)
+	files := map[string]interface{}{
+		"export.json":        map[string]interface{}{"subject": export.Subject, "exportedAt": export.ExportedAt},
+		"account.json":       export.Account,
+		"conversations.json": export.Conversations,
+	}
+	for _, s := range export.Sessions {
+		files["sessions/"+s.ID.Hex()+".json"] = s
+	}
+	for name, v := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			log.Printf("[PRIVACY][ERROR] Failed to write %s: %v", name, err)
+			break
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+	}
+	zw.Close()
+}
+
+// EraseUserDataHandler irreversibly anonymizes a customer. The body must
+// confirm the request.
+func EraseUserDataHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		UserID  string `json:"userId"`
+		Confirm bool   `json:"confirm"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || !body.Confirm {
+		http.Error(w, "Invalid request body: erasure must be confirmed", http.StatusBadRequest)
+		return
+	}
+	subject, ok := privacySubject(w, principal, body.UserID)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	record := models.ComplianceRecord{
+		Type:        utils.ComplianceErasure,
+		SubjectHash: utils.SubjectHash(subject),
+		RequestedBy: principal.ID,
+	}
+
+	result, err := utils.EraseUser(ctx, subject)
+	switch {
+	case errors.Is(err, utils.ErrLegalHold):
+		record.Outcome, record.Detail = utils.OutcomeRefused, err.Error()
+		logCompliance(ctx, record)
+		http.Error(w, "User data is under legal hold and cannot be erased", http.StatusConflict)
+		return
+	case err == mongo.ErrNoDocuments:
+		record.Outcome, record.Detail = utils.OutcomeFailed, "user not found"
+		logCompliance(ctx, record)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	case err != nil:
+		// A retry picks up where this left off: whatever was already
+		// anonymized no longer matches the email.
+		record.Outcome, record.Detail, record.Pseudonym = utils.OutcomeFailed, err.Error(), result.Pseudonym
+		logCompliance(ctx, record)
+		http.Error(w, "Failed to erase user data", http.StatusInternalServerError)
+		return
+	}
+
+	record.Outcome = utils.OutcomeCompleted
+	record.Pseudonym = result.Pseudonym
+	record.Counts = map[string]int64{
+		"sessions":      result.Sessions,
+		"messages":      result.Messages,
+		"conversations": result.Conversations,
+	}
+	logCompliance(ctx, record)
+	log.Printf("[PRIVACY] %s erased subject %s as %s", principal.ID, record.SubjectHash[:12], result.Pseudonym)
+
+	freed := false
+	for _, s := range result.Closed {
+		websocket.CancelAIReply(s.ID.Hex())
+		websocket.NotifySessionEnded(s.ID.Hex())
+		websocket.BroadcastSessionEnd(s.ID.Hex())
+		freed = freed || s.Mode == utils.ModeHuman
+	}
+	if freed {
+		websocket.RequestDispatch()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":       "User data erased",
+		"pseudonym":     result.Pseudonym,
+		"sessions":      result.Sessions,
+		"messages":      result.Messages,
+		"conversations": result.Conversations,
+	})
+}
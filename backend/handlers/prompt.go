@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func ListPromptTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if tenant := r.URL.Query().Get("tenant"); tenant != "" {
+		filter["tenant"] = tenant
+	}
+
+	cursor, err := utils.PromptColl().Find(ctx, filter)
+	if err != nil {
+		http.Error(w, "Failed to fetch prompt templates", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	templates := []models.PromptTemplate{}
+	if err := cursor.All(ctx, &templates); err != nil {
+		http.Error(w, "Failed to fetch prompt templates", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"templates": templates,
+		"default":   utils.DefaultPromptTemplate,
+	})
+}
+
+func SavePromptTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "PUT,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPut {
+		http.Error(w, "Only PUT allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var tpl models.PromptTemplate
+	if err := json.NewDecoder(r.Body).Decode(&tpl); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	tpl.Tenant = strings.TrimSpace(tpl.Tenant)
+	if tpl.Tenant == "" {
+		tpl.Tenant = utils.DefaultTenant
+	}
+	tpl.Channel = strings.TrimSpace(tpl.Channel)
+	tpl.UpdatedBy = principal.ID
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := utils.SavePromptTemplate(ctx, &tpl); err != nil {
+		log.Printf("[ADMIN][ERROR] Failed to save prompt template %s/%s: %v", tpl.Tenant, tpl.Channel, err)
+		http.Error(w, "Failed to save prompt template: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[ADMIN] %s updated prompt template %s/%s", principal.ID, tpl.Tenant, tpl.Channel)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tpl)
+}
+
+func DeletePromptTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "DELETE,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	tenant := r.URL.Query().Get("tenant")
+	if tenant == "" {
+		tenant = utils.DefaultTenant
+	}
+	channel := r.URL.Query().Get("channel")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := utils.PromptColl().DeleteOne(ctx, bson.M{"tenant": tenant, "channel": channel})
+	if err != nil {
+		http.Error(w, "Failed to delete prompt template", http.StatusInternalServerError)
+		return
+	}
+	if res.DeletedCount == 0 {
+		http.Error(w, "Prompt template not found", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("[ADMIN] %s deleted prompt template %s/%s", principal.ID, tenant, channel)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Prompt template deleted"})
+}
+
+// PreviewPromptHandler renders the system prompt a session would get right
+// now, so admins can check an edit before customers see it.
+func PreviewPromptHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	query := r.URL.Query()
+	tenant, channel, email := query.Get("tenant"), query.Get("channel"), query.Get("email")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var history []models.Message
+	if sessionId := query.Get("sessionId"); sessionId != "" {
+		sessionObjId, err := primitive.ObjectIDFromHex(sessionId)
+		if err != nil {
+			http.Error(w, "Invalid session ID", http.StatusBadRequest)
+			return
+		}
+		var session models.Session
+		if err := utils.SessionColl.FindOne(ctx, bson.M{"_id": sessionObjId}).Decode(&session); err != nil {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		tenant, channel, email = session.Tenant, session.Channel, session.UserID
+		history, _ = utils.FindSessionMessages(ctx, sessionObjId, 0)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"prompt": utils.SystemPrompt(ctx, tenant, channel, email, history),
+	})
+}
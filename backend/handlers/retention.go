@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func ListRetentionPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	policies, err := utils.RetentionPolicies(ctx)
+	if err != nil {
+		http.Error(w, "Failed to fetch retention policies", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"policies": policies})
+}
+
+func SaveRetentionPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "PUT,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPut {
+		http.Error(w, "Only PUT allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var policy models.RetentionPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	policy.Tenant = strings.TrimSpace(policy.Tenant)
+	policy.UpdatedBy = principal.ID
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := utils.SaveRetentionPolicy(ctx, &policy); err != nil {
+		http.Error(w, "Failed to save retention policy: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("[ADMIN] %s set retention of tenant=%q mode=%q status=%q to %d days",
+		principal.ID, policy.Tenant, policy.Mode, policy.Status, policy.RetainDays)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+func DeleteRetentionPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "DELETE,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	policyObjId, err := primitive.ObjectIDFromHex(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid policy ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := utils.RetentionPolicyColl().DeleteOne(ctx, bson.M{"_id": policyObjId})
+	if err != nil {
+		http.Error(w, "Failed to delete retention policy", http.StatusInternalServerError)
+		return
+	}
+	if res.DeletedCount == 0 {
+		http.Error(w, "Retention policy not found", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("[ADMIN] %s deleted retention policy %s", principal.ID, policyObjId.Hex())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Retention policy deleted"})
+}
+
+// PurgeSessionsHandler runs the purge on demand. It is a dry run unless the
+// body says "dryRun": false.
+func PurgeSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	body := struct {
+		DryRun *bool `json:"dryRun"`
+	}{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	dryRun := body.DryRun == nil || *body.DryRun
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	report, err := utils.PurgeExpiredSessions(ctx, dryRun)
+	if err != nil {
+		log.Printf("[RETENTION][ERROR] Purge requested by %s failed: %v", principal.ID, err)
+		http.Error(w, "Failed to purge sessions", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[RETENTION] %s purged %d sessions, %d messages and %d conversations (dry run: %t)",
+		principal.ID, report.Sessions, report.Messages, report.Conversations, report.DryRun)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// PurgeExpiredSessions is the scheduled purge.
+func PurgeExpiredSessions(dryRun bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	report, err := utils.PurgeExpiredSessions(ctx, dryRun)
+	if err != nil {
+		log.Printf("[RETENTION][ERROR] Purge failed: %v", err)
+		return
+	}
+	if report.Sessions > 0 || report.Conversations > 0 {
+		log.Printf("[RETENTION] Purged %d sessions, %d messages and %d conversations (dry run: %t)",
+			report.Sessions, report.Messages, report.Conversations, report.DryRun)
+	}
+}
+
+// LegalHoldHandler places or lifts a legal hold on a session or on all of a
+// customer's sessions, exempting them from purging.
+func LegalHoldHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		SessionID string `json:"sessionId"`
+		UserID    string `json:"userId"`
+		Hold      bool   `json:"hold"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || (body.SessionID == "") == (body.UserID == "") {
+		http.Error(w, "Invalid request body: give either sessionId or userId", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var found bool
+	var err error
+	target := body.UserID
+	if body.SessionID != "" {
+		sessionObjId, parseErr := primitive.ObjectIDFromHex(body.SessionID)
+		if parseErr != nil {
+			http.Error(w, "Invalid session ID", http.StatusBadRequest)
+			return
+		}
+		target = body.SessionID
+		found, err = utils.SetSessionLegalHold(ctx, sessionObjId, body.Hold)
+	} else {
+		found, err = utils.SetUserLegalHold(ctx, body.UserID, body.Hold)
+	}
+	if err != nil {
+		http.Error(w, "Failed to update legal hold", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Session or user not found", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("[ADMIN] %s set legal hold on %s to %t", principal.ID, target, body.Hold)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Legal hold updated",
+		"target":  target,
+		"hold":    body.Hold,
+	})
+}
@@ -9,24 +9,12 @@ import (
 	"net/http"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type SendMessage struct {
 	Message string `json:"message"`
-	UserID  string `json:"userId"`
-}
-
-type ChatEntry struct {
-	Sender    string    `json:"sender" bson:"sender"`
-	Text      string    `json:"text" bson:"text"`
-	Timestamp time.Time `json:"timestamp" bson:"timestamp"`
-}
-
-type ChatSession struct {
-	UserID       string      `bson:"userId"`
-	Messages     []ChatEntry `bson:"messages"`
-	LastActivity time.Time   `bson:"lastActivity"`
 }
 
 func SendHandler(w http.ResponseWriter, r *http.Request) {
@@ -35,38 +23,43 @@ func SendHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	var payload SendMessage
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		http.Error(w, "Geçersiz istek verisi", http.StatusBadRequest)
 		return
 	}
 
-	userMsg := ChatEntry{
+	userMsg := models.ConversationEntry{
 		Sender:    "user",
 		Text:      payload.Message,
 		Timestamp: time.Now(),
 	}
 
-	botReply, err := utils.AskGemini(payload.Message)
+	resp, err := utils.LLM.Complete(r.Context(), utils.LLMRequest{
+		System:   utils.SystemPrompt(r.Context(), utils.DefaultTenant, "api", principal.Email, nil),
+		Messages: []utils.LLMMessage{{Role: utils.LLMRoleUser, Text: redacted(payload.Message)}},
+	})
 	if err != nil {
-		http.Error(w, "Gemini AI'dan yanıt alınamadı", http.StatusInternalServerError)
+		http.Error(w, "AI'dan yanıt alınamadı", http.StatusInternalServerError)
 		return
 	}
+	botReply := resp.Text
 
-	botMsg := ChatEntry{
+	botMsg := models.ConversationEntry{
 		Sender:    "system",
 		Text:      botReply,
 		Timestamp: time.Now(),
 	}
 
-	collection := utils.Client.Database("ChatbotAI").Collection("messages")
-	session := ChatSession{
-		UserID:       payload.UserID,
-		Messages:     []ChatEntry{userMsg, botMsg},
-		LastActivity: time.Now(),
-	}
-
-	insertResult, err := collection.InsertOne(context.TODO(), session)
+	id, err := utils.InsertConversation(context.TODO(), bson.M{
+		"userId":       principal.Email,
+		"lastActivity": time.Now(),
+	}, "messages", []models.ConversationEntry{userMsg, botMsg})
 	if err != nil {
 		fmt.Println("MongoDB kayıt hatası:", err)
 		http.Error(w, "Veritabanı hatası", http.StatusInternalServerError)
@@ -76,7 +69,7 @@ func SendHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"reply": botReply,
-		"id":    insertResult.InsertedID.(interface{}).(string),
+		"id":    id.Hex(),
 	})
 }
 
@@ -105,8 +98,7 @@ func SessionMessageHandler(w http.ResponseWriter, r *http.Request) {
 		Text:      payload.Text,
 		Timestamp: time.Now(),
 	}
-	_, err = utils.MessageColl.InsertOne(context.Background(), msg)
-	if err != nil {
+	if err := utils.InsertSessionMessage(context.Background(), &msg); err != nil {
 		http.Error(w, "Failed to save message", http.StatusInternalServerError)
 		return
 	}
@@ -117,11 +109,16 @@ func SessionMessageHandler(w http.ResponseWriter, r *http.Request) {
 func SessionMessagesGetHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	sessionId := r.URL.Query().Get("sessionId")
 	if sessionId == "" {
 		http.Error(w, "sessionId required", http.StatusBadRequest)
@@ -132,27 +129,20 @@ func SessionMessagesGetHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid sessionId", http.StatusBadRequest)
 		return
 	}
-	filter := map[string]interface{}{"sessionId": sessionObjID}
-	cur, err := utils.MessageColl.Find(context.Background(), filter)
-	if err != nil {
-		http.Error(w, "Failed to fetch messages", http.StatusInternalServerError)
+
+	var session models.Session
+	if err := utils.SessionColl.FindOne(context.Background(), bson.M{"_id": sessionObjID}).Decode(&session); err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
 		return
 	}
-	defer cur.Close(context.Background())
-	var messages []models.Message
-	for cur.Next(context.Background()) {
-		var msg models.Message
-		if err := cur.Decode(&msg); err == nil {
-			messages = append(messages, msg)
-		}
+	if !canAccessSession(principal, session) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
 	}
-
-	for i := 0; i < len(messages)-1; i++ {
-		for j := i + 1; j < len(messages); j++ {
-			if messages[i].Timestamp.After(messages[j].Timestamp) {
-				messages[i], messages[j] = messages[j], messages[i]
-			}
-		}
+	messages, err := utils.FindSessionMessages(context.Background(), sessionObjID, 0)
+	if err != nil {
+		http.Error(w, "Failed to fetch messages", http.StatusInternalServerError)
+		return
 	}
 
 	var formattedMessages []map[string]interface{}
@@ -160,9 +150,11 @@ func SessionMessagesGetHandler(w http.ResponseWriter, r *http.Request) {
 		formattedMessages = append(formattedMessages, map[string]interface{}{
 			"id":        msg.ID.Hex(),
 			"sessionId": msg.SessionID.Hex(),
+			"seq":       msg.Seq,
 			"sender":    msg.Sender,
 			"text":      msg.Text,
 			"timestamp": msg.Timestamp.Format("2006-01-02T15:04:05Z07:00"),
+			"citations": msg.Citations,
 		})
 	}
 
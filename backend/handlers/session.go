@@ -3,7 +3,9 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"backend/models"
@@ -12,25 +14,67 @@ import (
 	"fmt"
 
 	"github.com/gorilla/mux"
-	gorillaws "github.com/gorilla/websocket"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// CleanupOldSessions closes sessions that went idle and tells whoever is
+// still connected. Closed sessions stay in place until ArchiveOldSessions
+// moves them.
 func CleanupOldSessions() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	thirtyMinutesAgo := time.Now().Add(-30 * time.Minute)
+	closed, err := utils.CloseIdleSessions(ctx)
+	if err != nil {
+		fmt.Printf("[CLEANUP][ERROR] Boşta kalan session'lar kapatılamadı: %v\n", err)
+	}
+	if len(closed) == 0 {
+		return
+	}
+	fmt.Printf("[CLEANUP][INFO] %d boşta kalan session kapatıldı\n", len(closed))
 
-	result, err := utils.SessionColl.DeleteMany(ctx, bson.M{
-		"lastActivity": bson.M{"$lt": thirtyMinutesAgo},
-	})
+	freed := false
+	for _, session := range closed {
+		websocket.CancelAIReply(session.ID.Hex())
+		websocket.NotifySessionEnded(session.ID.Hex())
+		websocket.BroadcastSessionEnd(session.ID.Hex())
+		freed = freed || session.Mode == utils.ModeHuman
+	}
+	if freed {
+		websocket.RequestDispatch()
+	}
+}
 
+// ArchiveOldSessions moves long-completed sessions and their messages to the
+// archive collections.
+func ArchiveOldSessions() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	archived, err := utils.ArchiveSessions(ctx)
 	if err != nil {
-		fmt.Printf("[CLEANUP][ERROR] Eski session'lar temizlenemedi: %v\n", err)
-	} else {
-		fmt.Printf("[CLEANUP][INFO] %d eski session temizlendi\n", result.DeletedCount)
+		fmt.Printf("[ARCHIVE][ERROR] Session'lar arşivlenemedi: %v\n", err)
+		return
+	}
+	if archived > 0 {
+		fmt.Printf("[ARCHIVE][INFO] %d session arşivlendi\n", archived)
+	}
+}
+
+// RotateMessageKeys moves stored message text onto the active key, a batch
+// at a time.
+func RotateMessageKeys(batch int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	rotated, err := utils.RotateMessageKeys(ctx, batch)
+	if err != nil {
+		fmt.Printf("[CRYPTO][ERROR] Key rotation failed: %v\n", err)
+		return
+	}
+	if rotated > 0 {
+		fmt.Printf("[CRYPTO][INFO] Moved %d messages to the active key\n", rotated)
 	}
 }
 
@@ -65,17 +109,65 @@ func CleanupUserSessions(userID string) {
 
 		for _, session := range sessions {
 			if session.ID != latestSession.ID {
-				utils.SessionColl.DeleteOne(ctx, bson.M{"_id": session.ID})
-				fmt.Printf("[CLEANUP][INFO] User %s için eski session silindi: %s\n", userID, session.ID.Hex())
+				if ok, err := utils.CloseSession(ctx, session, utils.ActorSystem, utils.CloseDuplicate); err == nil && ok {
+					websocket.BroadcastSessionEnd(session.ID.Hex())
+				}
+				fmt.Printf("[CLEANUP][INFO] User %s için eski session kapatıldı: %s\n", userID, session.ID.Hex())
 			}
 		}
 	}
 }
 
+func canAccessSession(principal *utils.Principal, session models.Session) bool {
+	if utils.IsStaffRole(principal.Role) {
+		return true
+	}
+	return principal.Role == utils.RoleCustomer && session.UserID == principal.Email
+}
+
+// canTransferSession lets agents hand over their own sessions; moving anyone
+// else's takes the reassign permission. MoveSession only succeeds if the
+// session is still as checked here.
+func canTransferSession(principal *utils.Principal, session models.Session) bool {
+	if utils.HasPermission(principal.Role, utils.PermSessionReassign) {
+		return true
+	}
+	return utils.IsStaffRole(principal.Role) && session.Mode == utils.ModeHuman && session.AssignedAgent == principal.ID
+}
+
+// actorOf names the principal in a session's history the way sessions refer
+// to them: customers by email, staff by id.
+func actorOf(principal *utils.Principal) string {
+	if utils.IsStaffRole(principal.Role) {
+		return principal.ID
+	}
+	return principal.Email
+}
+
+// sessionConflict answers a lost race for a session with 409 Conflict and
+// whoever holds the session now, so the caller can refresh instead of
+// retrying blindly.
+func sessionConflict(ctx context.Context, w http.ResponseWriter, sessionID primitive.ObjectID) {
+	var current models.Session
+	if err := utils.SessionColl.FindOne(ctx, bson.M{"_id": sessionID}).Decode(&current); err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":       "Session is already assigned to another agent",
+		"sessionId":     current.ID.Hex(),
+		"assignedAgent": current.AssignedAgent,
+		"mode":          current.Mode,
+		"status":        current.Status,
+	})
+}
+
 func StartSessionHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST,OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
@@ -85,23 +177,49 @@ func StartSessionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var body struct {
-		UserID  string `json:"userId"`
-		AgentID string `json:"agentId"`
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.UserID == "" {
+
+	var body struct {
+		AgentID      string `json:"agentId"`
+		RequestAgent bool   `json:"requestAgent"`
+		Tenant       string `json:"tenant"`
+		Channel      string `json:"channel"`
+		Skill        string `json:"skill"`
+		Language     string `json:"language"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	body.Skill = strings.ToLower(strings.TrimSpace(body.Skill))
+	if body.Skill != "" && !utils.IsSkill(body.Skill) {
+		http.Error(w, "Unknown skill", http.StatusBadRequest)
+		return
+	}
+	language, err := utils.NormalizeLanguage(body.Language)
+	if err != nil {
+		http.Error(w, "Invalid language", http.StatusBadRequest)
+		return
+	}
+	userID := principal.Email
+	if body.Tenant == "" {
+		body.Tenant = utils.DefaultTenant
+	}
+	if body.Channel == "" {
+		body.Channel = utils.DefaultChannel
+	}
 
-	CleanupUserSessions(body.UserID)
+	CleanupUserSessions(userID)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	var existingSession models.Session
-	err := utils.SessionColl.FindOne(ctx, bson.M{
-		"userId": body.UserID,
+	err = utils.SessionColl.FindOne(ctx, bson.M{
+		"userId": userID,
 		"status": bson.M{"$in": []string{"active", "waiting_for_agent"}},
 	}).Decode(&existingSession)
 
@@ -109,134 +227,127 @@ func StartSessionHandler(w http.ResponseWriter, r *http.Request) {
 		fmt.Printf("[SESSION][INFO] Önceki session bulundu: %s, Agent: %s, Mode: %s\n",
 			existingSession.ID.Hex(), existingSession.AssignedAgent, existingSession.Mode)
 
-		if existingSession.Mode == "human" && existingSession.AssignedAgent != "System" {
+		if utils.SessionState(existingSession) == utils.StateAgent {
 			agentObjId, _ := primitive.ObjectIDFromHex(existingSession.AssignedAgent)
 			var agent models.Agent
-			agentErr := utils.AgentColl.FindOne(ctx, bson.M{"_id": agentObjId, "status": "available"}).Decode(&agent)
-
-			if agentErr == nil {
-				_, updateErr := utils.SessionColl.UpdateOne(ctx,
-					bson.M{"_id": existingSession.ID},
-					bson.M{"$set": bson.M{
-						"lastActivity": time.Now(),
-						"status":       "active",
-					}},
-				)
-				if updateErr != nil {
-					fmt.Printf("[SESSION][ERROR] Session güncellenemedi: %v\n", updateErr)
-				}
+			agentErr := utils.AgentColl.FindOne(ctx, bson.M{"_id": agentObjId, "status": bson.M{"$in": []string{"available", "busy"}}}).Decode(&agent)
 
-				w.Header().Set("Content-Type", "application/json")
-				json.NewEncoder(w).Encode(map[string]string{
-					"sessionId":     existingSession.ID.Hex(),
-					"assignedAgent": existingSession.AssignedAgent,
-					"mode":          existingSession.Mode,
-					"status":        "continued",
-				})
-				return
-			} else {
+			if agentErr != nil {
 				fmt.Printf("[SESSION][INFO] Agent %s artık uygun değil, sistem devreye giriyor\n", existingSession.AssignedAgent)
-				_, updateErr := utils.SessionColl.UpdateOne(ctx,
-					bson.M{"_id": existingSession.ID},
-					bson.M{"$set": bson.M{
-						"assignedAgent": "System",
-						"mode":          "system",
-						"status":        "active",
-						"lastActivity":  time.Now(),
-					}},
-				)
+				updated, moved, updateErr := utils.TransitionSession(ctx, existingSession, utils.Transition{
+					To:     utils.StateAI,
+					Actor:  utils.ActorSystem,
+					Reason: "agent_unavailable",
+					Set:    bson.M{"assignedAgent": "System"},
+				})
 				if updateErr != nil {
 					fmt.Printf("[SESSION][ERROR] Session sistem transfer edilemedi: %v\n", updateErr)
+				} else if moved {
+					utils.ReleaseAgent(ctx, agentObjId)
+					writeSessionStart(w, updated, true)
+					return
 				}
-
-				w.Header().Set("Content-Type", "application/json")
-				json.NewEncoder(w).Encode(map[string]string{
-					"sessionId":     existingSession.ID.Hex(),
-					"assignedAgent": "System",
-					"mode":          "system",
-					"status":        "transferred_to_system",
-				})
-				return
-			}
-		} else if existingSession.Mode == "system" {
-			_, updateErr := utils.SessionColl.UpdateOne(ctx,
-				bson.M{"_id": existingSession.ID},
-				bson.M{"$set": bson.M{
-					"lastActivity": time.Now(),
-					"status":       "active",
-				}},
-			)
-			if updateErr != nil {
-				fmt.Printf("[SESSION][ERROR] Sistem session güncellenemedi: %v\n", updateErr)
 			}
+		}
 
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]string{
-				"sessionId":     existingSession.ID.Hex(),
-				"assignedAgent": existingSession.AssignedAgent,
-				"mode":          existingSession.Mode,
-				"status":        "continued_system",
-			})
-			return
+		_, updateErr := utils.SessionColl.UpdateOne(ctx,
+			bson.M{"_id": existingSession.ID},
+			bson.M{"$set": bson.M{"lastActivity": time.Now()}},
+		)
+		if updateErr != nil {
+			fmt.Printf("[SESSION][ERROR] Session güncellenemedi: %v\n", updateErr)
 		}
+		writeSessionStart(w, existingSession, true)
+		return
 	}
 
 	assigned := "System"
-	mode := "system"
-	status := "active"
+	mode := utils.ModeSystem
+	status := utils.StatusActive
+	var queuedAt time.Time
 
 	if body.AgentID != "" {
 		agentObjId, _ := primitive.ObjectIDFromHex(body.AgentID)
-		assigned = body.AgentID
-		mode = "human"
-		_, err := utils.AgentColl.UpdateOne(ctx, bson.M{"_id": agentObjId}, bson.M{"$set": bson.M{"status": "busy"}})
+		claimed, err := utils.ClaimAgent(ctx, agentObjId)
 		if err != nil {
 			fmt.Printf("[SESSION][ERROR] Agent status 'busy' yapılamadı: %v\n", err)
-		} else {
+		}
+		if claimed {
+			assigned = body.AgentID
+			mode = utils.ModeHuman
 			fmt.Printf("[SESSION][OK] Agent doğrudan atandı ve status 'busy': %s\n", body.AgentID)
+		} else {
+			fmt.Printf("[SESSION][INFO] Agent %s uygun değil, session kuyruğa alınıyor\n", body.AgentID)
+			body.RequestAgent = true
 		}
-	} else {
+	}
+	if mode == utils.ModeSystem && body.RequestAgent {
+		status = utils.StatusWaiting
+		queuedAt = time.Now()
+	} else if mode == utils.ModeSystem {
 		fmt.Printf("[SESSION][INFO] Agent talep edilmedi, sistem modunda başlatılıyor.\n")
 	}
 
 	session := models.Session{
-		UserID:        body.UserID,
+		UserID:        userID,
 		AssignedAgent: assigned,
 		Mode:          mode,
 		Status:        status,
 		CreatedAt:     time.Now(),
 		LastActivity:  time.Now(),
-	}
-	res, err := utils.SessionColl.InsertOne(ctx, session)
-	if err != nil {
+		Tenant:        body.Tenant,
+		Channel:       body.Channel,
+		QueuedAt:      queuedAt,
+		RequiredSkill: body.Skill,
+		Language:      language,
+	}
+	reason := "start"
+	if mode == utils.ModeHuman {
+		reason = "direct_assignment"
+	} else if status == utils.StatusWaiting {
+		reason = "request_agent"
+	}
+	if err := utils.NewSession(ctx, &session, principal.Email, reason); err != nil {
+		if mode == utils.ModeHuman {
+			utils.ReleaseAgentByID(ctx, assigned)
+		}
 		http.Error(w, "Failed to create session", http.StatusInternalServerError)
 		return
 	}
 
-	session.ID = res.InsertedID.(primitive.ObjectID)
-	sessionData := map[string]interface{}{
+	websocket.BroadcastNewSession(websocket.SessionEvent{
+		SessionID:     session.ID.Hex(),
+		UserID:        session.UserID,
+		AssignedAgent: session.AssignedAgent,
+		Mode:          session.Mode,
+		Status:        session.Status,
+		LastActivity:  session.LastActivity,
+	})
+
+	if status == utils.StatusWaiting {
+		websocket.RequestDispatch()
+	}
+	writeSessionStart(w, session, false)
+}
+
+// writeSessionStart answers a start request with the session the customer
+// ends up in; resumed tells an already open session from a new one.
+func writeSessionStart(w http.ResponseWriter, session models.Session, resumed bool) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
 		"sessionId":     session.ID.Hex(),
-		"userId":        session.UserID,
 		"assignedAgent": session.AssignedAgent,
 		"mode":          session.Mode,
 		"status":        session.Status,
-		"lastActivity":  session.LastActivity,
-	}
-	websocket.BroadcastNewSession(sessionData)
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"sessionId":     res.InsertedID.(primitive.ObjectID).Hex(),
-		"assignedAgent": assigned,
-		"mode":          mode,
-		"status":        "new",
+		"state":         utils.SessionState(session),
+		"resumed":       resumed,
 	})
 }
 
 func TransferToAgentHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST,OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
@@ -246,6 +357,11 @@ func TransferToAgentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	var body struct {
 		SessionID string `json:"sessionId"`
 		AgentID   string `json:"agentId"`
@@ -270,61 +386,50 @@ func TransferToAgentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var agent models.Agent
-	err = utils.AgentColl.FindOne(ctx, bson.M{"_id": agentObjId, "status": "available"}).Decode(&agent)
-	if err != nil {
-		http.Error(w, "Agent not available", http.StatusBadRequest)
+	var current models.Session
+	if err := utils.SessionColl.FindOne(ctx, bson.M{"_id": sessionObjId}).Decode(&current); err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
 		return
 	}
-
-	_, err = utils.SessionColl.UpdateOne(ctx,
-		bson.M{"_id": sessionObjId},
-		bson.M{"$set": bson.M{
-			"assignedAgent": body.AgentID,
-			"mode":          "human",
-			"status":        "active",
-			"lastActivity":  time.Now(),
-		}},
-	)
-	if err != nil {
-		http.Error(w, "Failed to transfer session", http.StatusInternalServerError)
+	if !canTransferSession(principal, current) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
 
-	_, err = utils.AgentColl.UpdateOne(ctx,
-		bson.M{"_id": agentObjId},
-		bson.M{"$set": bson.M{"status": "busy"}},
-	)
-	if err != nil {
-		fmt.Printf("[TRANSFER][ERROR] Agent status 'busy' yapılamadı: %v\n", err)
+	alreadyAssigned := current.Mode == "human" && current.AssignedAgent == body.AgentID
+	if !alreadyAssigned {
+		claimed, err := utils.ClaimAgent(ctx, agentObjId)
+		if err != nil || !claimed {
+			http.Error(w, "Agent not available", http.StatusBadRequest)
+			return
+		}
 	}
 
-	var sessionData models.Session
-	utils.SessionColl.FindOne(ctx, bson.M{"_id": sessionObjId}).Decode(&sessionData)
-
-	userConn := websocket.GetUserConn(sessionData.UserID)
-	if userConn != nil {
-		userNotification := map[string]interface{}{
-			"sender":        "system",
-			"mode":          "human",
-			"status":        "active",
-			"assignedAgent": body.AgentID,
+	sessionData, moved, err := utils.MoveSession(ctx, current, body.AgentID, actorOf(principal), "transfer")
+	if err != nil || !moved {
+		if !alreadyAssigned {
+			utils.ReleaseAgent(ctx, agentObjId)
 		}
-		jsonData, _ := json.Marshal(userNotification)
-		userConn.WriteMessage(gorillaws.TextMessage, jsonData)
-		fmt.Printf("[TRANSFER] Notified user %s about agent assignment", sessionData.UserID)
+		if err != nil && !errors.Is(err, utils.ErrIllegalTransition) {
+			http.Error(w, "Failed to transfer session", http.StatusInternalServerError)
+			return
+		}
+		sessionConflict(ctx, w, sessionObjId)
+		return
 	}
+	websocket.CancelAIReply(body.SessionID)
 
-	var messages []models.Message
-	messageCursor, err := utils.MessageColl.Find(ctx, bson.M{"sessionId": sessionObjId})
-	if err == nil {
-		defer messageCursor.Close(ctx)
-		for messageCursor.Next(ctx) {
-			var msg models.Message
-			if err := messageCursor.Decode(&msg); err == nil {
-				messages = append(messages, msg)
-			}
-		}
+	if !alreadyAssigned && current.Mode == "human" {
+		utils.ReleaseAgentByID(ctx, current.AssignedAgent)
+	}
+
+	if websocket.NotifySessionState(sessionData.UserID, body.SessionID, "human", "active", body.AgentID) {
+		fmt.Printf("[TRANSFER] Notified user %s about agent assignment\n", sessionData.UserID)
+	}
+
+	messages, err := utils.FindSessionMessages(ctx, sessionObjId, 0)
+	if err != nil {
+		fmt.Printf("[TRANSFER][ERROR] Failed to load history: %v\n", err)
 	}
 
 	var user struct {
@@ -351,13 +456,23 @@ func TransferToAgentHandler(w http.ResponseWriter, r *http.Request) {
 func GetAgentSessionsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET,OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	agentId := vars["agentId"]
+	if agentId != principal.ID && !utils.HasPermission(principal.Role, utils.PermAgentViewAll) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -403,11 +518,16 @@ func GetAgentSessionsHandler(w http.ResponseWriter, r *http.Request) {
 func GetSessionInfoHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET,OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	sessionId := r.URL.Query().Get("sessionId")
 	if sessionId == "" {
 		w.Header().Set("Content-Type", "application/json")
@@ -429,17 +549,62 @@ func GetSessionInfoHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `{"error":"Session not found"}`, http.StatusNotFound)
 		return
 	}
+	if !canAccessSession(principal, session) {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"error":"Forbidden"}`, http.StatusForbidden)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"mode":          session.Mode,
+		"status":        session.Status,
 		"assignedAgent": session.AssignedAgent,
 	})
 }
 
+// GetSessionEventsHandler returns a session's state transitions for staff
+// auditing it.
+func GetSessionEventsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	sessionObjId, err := primitive.ObjectIDFromHex(r.URL.Query().Get("sessionId"))
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var session models.Session
+	if err := utils.SessionColl.FindOne(ctx, bson.M{"_id": sessionObjId}).Decode(&session); err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	events, err := utils.FindSessionEvents(ctx, sessionObjId)
+	if err != nil {
+		http.Error(w, "Failed to fetch session events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sessionId": session.ID.Hex(),
+		"state":     utils.SessionState(session),
+		"events":    events,
+	})
+}
+
 func EndSessionHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST,OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
@@ -449,6 +614,11 @@ func EndSessionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	var body struct {
 		SessionID string `json:"sessionId"`
 	}
@@ -472,22 +642,34 @@ func EndSessionHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Session not found", http.StatusNotFound)
 		return
 	}
-
-	_, err = utils.SessionColl.UpdateOne(ctx,
-		bson.M{"_id": sessionObjId},
-		bson.M{"$set": bson.M{
-			"status":       "completed",
-			"lastActivity": time.Now(),
-		}},
-	)
-	if err != nil {
-		http.Error(w, "Failed to end session", http.StatusInternalServerError)
+	if utils.IsStaffRole(principal.Role) && session.AssignedAgent != principal.ID &&
+		!utils.HasPermission(principal.Role, utils.PermSessionEndAny) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !canAccessSession(principal, session) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
 
-	if session.AssignedAgent != "System" && session.AssignedAgent != "" {
-		agentObjId, _ := primitive.ObjectIDFromHex(session.AssignedAgent)
-		utils.AgentColl.UpdateOne(ctx, bson.M{"_id": agentObjId}, bson.M{"$set": bson.M{"status": "available"}})
+	// Ending an ended session is a no-op, and only the request that actually
+	// ends the session frees the agent's slot.
+	ended := false
+	if utils.SessionState(session) != utils.StateCompleted {
+		ended, err = utils.CloseSession(ctx, session, actorOf(principal), utils.CloseEnded)
+		if err != nil {
+			http.Error(w, "Failed to end session", http.StatusInternalServerError)
+			return
+		}
+		if !ended {
+			sessionConflict(ctx, w, sessionObjId)
+			return
+		}
+	}
+	websocket.CancelAIReply(body.SessionID)
+
+	if ended && session.Mode == utils.ModeHuman {
+		websocket.RequestDispatch()
 	}
 
 	websocket.NotifySessionEnded(body.SessionID)
@@ -503,17 +685,26 @@ func EndSessionHandler(w http.ResponseWriter, r *http.Request) {
 func GetUserActiveSessionHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET,OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	userID := r.URL.Query().Get("userId")
 	if userID == "" {
 		http.Error(w, "userId required", http.StatusBadRequest)
 		return
 	}
+	if !utils.IsStaffRole(principal.Role) && userID != principal.Email {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -550,12 +741,17 @@ func GetUserActiveSessionHandler(w http.ResponseWriter, r *http.Request) {
 func GetUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET,OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	userID := vars["userId"]
 
@@ -563,6 +759,10 @@ func GetUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "User ID is required", http.StatusBadRequest)
 		return
 	}
+	if !utils.IsStaffRole(principal.Role) && userID != principal.Email {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -592,29 +792,8 @@ func GetUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
 		var session models.Session
 		if err := cursor.Decode(&session); err == nil {
 			var lastMessage string
-			messageCursor, err := utils.MessageColl.Find(ctx, bson.M{
-				"sessionId": session.ID,
-			})
-
-			if err == nil {
-				var messages []models.Message
-				for messageCursor.Next(ctx) {
-					var message models.Message
-					if err := messageCursor.Decode(&message); err == nil {
-						messages = append(messages, message)
-					}
-				}
-				messageCursor.Close(ctx)
-
-				if len(messages) > 0 {
-					var latestMessage models.Message
-					for _, msg := range messages {
-						if msg.Timestamp.After(latestMessage.Timestamp) {
-							latestMessage = msg
-						}
-					}
-					lastMessage = latestMessage.Text
-				}
+			if latest, err := utils.LastSessionMessage(ctx, session.ID); err == nil {
+				lastMessage = latest.Text
 			}
 
 			sessions = append(sessions, map[string]interface{}{
@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+	"backend/websocket"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func ListAgentsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["status"] = status
+	}
+
+	cursor, err := utils.AgentColl.Find(ctx, filter)
+	if err != nil {
+		http.Error(w, "Failed to fetch agents", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	agents := []map[string]interface{}{}
+	for cursor.Next(ctx) {
+		var a Agent
+		if err := cursor.Decode(&a); err != nil {
+			continue
+		}
+
+		// Presence is combined across instances and stored on the agent.
+		presence := a.Presence
+		if presence == "" {
+			presence = websocket.PresenceOffline
+		}
+		agents = append(agents, map[string]interface{}{
+			"id":             a.ID.Hex(),
+			"name":           a.Name,
+			"email":          a.Email,
+			"role":           utils.StaffRole(a.Role),
+			"status":         a.Status,
+			"presence":       presence,
+			"lastSeen":       a.LastSeen,
+			"activeSessions": a.ActiveSessions,
+			"maxConcurrent":  utils.AgentCapacity(a.MaxConcurrent),
+			"skills":         a.Skills,
+			"languages":      a.Languages,
+			"createdAt":      a.CreatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"agents": agents})
+}
+
+func ReassignSessionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		SessionID string `json:"sessionId"`
+		AgentID   string `json:"agentId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.SessionID == "" || body.AgentID == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	sessionObjId, err := primitive.ObjectIDFromHex(body.SessionID)
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+	agentObjId, err := primitive.ObjectIDFromHex(body.AgentID)
+	if err != nil {
+		http.Error(w, "Invalid agent ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var agent models.Agent
+	if err := utils.AgentColl.FindOne(ctx, bson.M{"_id": agentObjId}).Decode(&agent); err != nil {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+
+	var session models.Session
+	err = utils.SessionColl.FindOne(ctx, bson.M{
+		"_id":    sessionObjId,
+		"status": bson.M{"$in": []string{utils.StatusActive, utils.StatusWaiting}},
+	}).Decode(&session)
+	if err != nil {
+		http.Error(w, "Session not found or not active", http.StatusNotFound)
+		return
+	}
+
+	previousAgent := session.AssignedAgent
+
+	_, moved, err := utils.MoveSession(ctx, session, body.AgentID, principal.ID, "reassign")
+	if err != nil && !errors.Is(err, utils.ErrIllegalTransition) {
+		http.Error(w, "Failed to reassign session", http.StatusInternalServerError)
+		return
+	}
+	if !moved {
+		sessionConflict(ctx, w, sessionObjId)
+		return
+	}
+
+	wasHuman := session.Mode == "human"
+	if !wasHuman || previousAgent != body.AgentID {
+		if err := utils.AddAgentLoad(ctx, agentObjId); err != nil {
+			log.Printf("[REASSIGN][ERROR] Agent yükü artırılamadı: %v", err)
+		}
+		if wasHuman {
+			utils.ReleaseAgentByID(ctx, previousAgent)
+		}
+	}
+	websocket.CancelAIReply(body.SessionID)
+
+	log.Printf("[REASSIGN] Supervisor %s moved session %s from %s to %s", principal.ID, body.SessionID, previousAgent, body.AgentID)
+
+	websocket.BroadcastSessionUpdate(websocket.SessionEvent{
+		SessionID:     body.SessionID,
+		UserID:        session.UserID,
+		AssignedAgent: body.AgentID,
+		PreviousAgent: previousAgent,
+		Mode:          "human",
+		Status:        "active",
+		LastActivity:  time.Now(),
+		Action:        "reassign",
+	})
+
+	websocket.NotifySessionState(session.UserID, body.SessionID, "human", "active", body.AgentID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":       "Session reassigned",
+		"sessionId":     body.SessionID,
+		"agentId":       body.AgentID,
+		"previousAgent": previousAgent,
+	})
+}
+
+func SetAgentRoleHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		AgentID string `json:"agentId"`
+		Role    string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.AgentID == "" || !utils.IsStaffRole(body.Role) {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if body.AgentID == principal.ID && body.Role != utils.RoleAdmin {
+		http.Error(w, "Admins cannot demote themselves", http.StatusBadRequest)
+		return
+	}
+
+	agentObjId, err := primitive.ObjectIDFromHex(body.AgentID)
+	if err != nil {
+		http.Error(w, "Invalid agent ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := utils.AgentColl.UpdateOne(ctx, bson.M{"_id": agentObjId}, bson.M{"$set": bson.M{"role": body.Role}})
+	if err != nil {
+		http.Error(w, "Failed to update role", http.StatusInternalServerError)
+		return
+	}
+	if res.MatchedCount == 0 {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("[ADMIN] %s set role of agent %s to %s", principal.ID, body.AgentID, body.Role)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Role updated",
+		"agentId": body.AgentID,
+		"role":    body.Role,
+	})
+}
+
+func SetAgentCapacityHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		AgentID       string `json:"agentId"`
+		MaxConcurrent int    `json:"maxConcurrent"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.AgentID == "" || body.MaxConcurrent < 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	agentObjId, err := primitive.ObjectIDFromHex(body.AgentID)
+	if err != nil {
+		http.Error(w, "Invalid agent ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	found, err := utils.SetAgentCapacity(ctx, agentObjId, body.MaxConcurrent)
+	if err != nil {
+		http.Error(w, "Failed to update capacity", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+	websocket.RequestDispatch()
+
+	log.Printf("[SUPERVISOR] %s set max concurrent sessions of agent %s to %d", principal.ID, body.AgentID, body.MaxConcurrent)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":       "Capacity updated",
+		"agentId":       body.AgentID,
+		"maxConcurrent": utils.AgentCapacity(body.MaxConcurrent),
+	})
+}
+
+func SetAgentSkillsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		AgentID   string   `json:"agentId"`
+		Skills    []string `json:"skills"`
+		Languages []string `json:"languages"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.AgentID == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	skills, err := utils.NormalizeSkills(body.Skills)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	languages, err := utils.NormalizeLanguages(body.Languages)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	agentObjId, err := primitive.ObjectIDFromHex(body.AgentID)
+	if err != nil {
+		http.Error(w, "Invalid agent ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	found, err := utils.SetAgentSkills(ctx, agentObjId, skills, languages)
+	if err != nil {
+		http.Error(w, "Failed to update skills", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+	websocket.RequestDispatch()
+
+	log.Printf("[SUPERVISOR] %s set skills of agent %s to %v, languages %v", principal.ID, body.AgentID, skills, languages)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   "Skills updated",
+		"agentId":   body.AgentID,
+		"skills":    skills,
+		"languages": languages,
+	})
+}
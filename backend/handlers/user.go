@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"log"
 	"net/http"
 	"time"
 
@@ -17,13 +18,14 @@ type User struct {
 	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Name     string             `json:"name" bson:"name"`
 	Email    string             `json:"email" bson:"email"`
-	Password string             `json:"password" bson:"password"`
+	Password string             `json:"-" bson:"password"`
+	Role     string             `json:"role" bson:"role,omitempty"`
 }
 
 func UserRegisterHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
@@ -35,11 +37,19 @@ func UserRegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var user User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+	var input struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
 		return
 	}
+	if input.Email == "" || input.Password == "" {
+		http.Error(w, `{"error": "Email and password are required"}`, http.StatusBadRequest)
+		return
+	}
 
 	collection := utils.MongoDB.Collection("users")
 
@@ -47,12 +57,25 @@ func UserRegisterHandler(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	var existing User
-	err := collection.FindOne(ctx, bson.M{"email": user.Email}).Decode(&existing)
+	err := collection.FindOne(ctx, bson.M{"email": input.Email}).Decode(&existing)
 	if err == nil {
 		http.Error(w, `{"error": "Email already registered"}`, http.StatusConflict)
 		return
 	}
 
+	hashed, err := utils.HashPassword(input.Password)
+	if err != nil {
+		http.Error(w, `{"error": "Failed to register user"}`, http.StatusInternalServerError)
+		return
+	}
+
+	user := User{
+		Name:     input.Name,
+		Email:    input.Email,
+		Password: hashed,
+		Role:     utils.RoleCustomer,
+	}
+
 	result, err := collection.InsertOne(ctx, user)
 	if err != nil {
 		http.Error(w, `{"error": "Failed to register user"}`, http.StatusInternalServerError)
@@ -71,7 +94,7 @@ func UserRegisterHandler(w http.ResponseWriter, r *http.Request) {
 func UserLoginHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
@@ -104,27 +127,61 @@ func UserLoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if user.Password != creds.Password {
+	ok, needsRehash := utils.CheckPassword(user.Password, creds.Password)
+	if !ok {
 		http.Error(w, `{"error": "Wrong password"}`, http.StatusUnauthorized)
 		return
 	}
 
+	if needsRehash {
+		if hashed, err := utils.HashPassword(creds.Password); err == nil {
+			_, err = collection.UpdateOne(ctx,
+				bson.M{"_id": user.ID, "password": user.Password},
+				bson.M{"$set": bson.M{"password": hashed}},
+			)
+			if err != nil {
+				log.Printf("[USER LOGIN][ERROR] Failed to rehash legacy password for %s: %v", user.ID.Hex(), err)
+			} else {
+				log.Printf("[USER LOGIN][MIGRATE] Rehashed legacy plaintext password for %s", user.ID.Hex())
+			}
+		}
+	}
+
+	tokens, err := utils.IssueTokens(utils.Principal{
+		ID:    user.ID.Hex(),
+		Email: user.Email,
+		Role:  utils.CustomerRole(user.Role),
+	})
+	if err != nil {
+		http.Error(w, `{"error": "Failed to issue token"}`, http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Login successful",
-		"userId":  user.ID.Hex(),
+		"message":      "Login successful",
+		"userId":       user.ID.Hex(),
+		"accessToken":  tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
+		"tokenType":    tokens.TokenType,
+		"expiresIn":    tokens.ExpiresIn,
 	})
 }
 
 func GetUserInfoHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET,OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	userID := vars["userId"]
 
@@ -136,19 +193,23 @@ func GetUserInfoHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	userObjID, err := primitive.ObjectIDFromHex(userID)
-	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
-		return
+	filter := bson.M{"email": userID}
+	if userObjID, err := primitive.ObjectIDFromHex(userID); err == nil {
+		filter = bson.M{"_id": userObjID}
 	}
 
 	var user User
-	err = utils.MongoDB.Collection("users").FindOne(ctx, bson.M{"_id": userObjID}).Decode(&user)
+	err := utils.MongoDB.Collection("users").FindOne(ctx, filter).Decode(&user)
 	if err != nil {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
+	if !utils.IsStaffRole(principal.Role) && principal.ID != user.ID.Hex() {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"id":    user.ID.Hex(),
@@ -4,6 +4,7 @@ import (
 	"backend/handlers"
 	"backend/utils"
 	"backend/websocket"
+	"context"
 	"log"
 	"net/http"
 	"os"
@@ -22,8 +23,31 @@ func main() {
 		log.Fatalf("Mongo init failed: %v", err)
 	}
 
+	seedCtx, seedCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	err := utils.SeedBootstrapAdmin(seedCtx)
+	seedCancel()
+	if err != nil {
+		log.Fatalf("Admin bootstrap failed: %v", err)
+	}
+
+	if err := utils.InitMessageEncryption(); err != nil {
+		log.Fatalf("Message encryption init failed: %v", err)
+	}
+
+	if err := utils.InitLLM(); err != nil {
+		log.Fatalf("LLM init failed: %v", err)
+	}
+
+	if err := utils.InitEmbedder(); err != nil {
+		log.Fatalf("Embedder init failed: %v", err)
+	}
+
+	if err := websocket.Init(); err != nil {
+		log.Fatalf("WebSocket init failed: %v", err)
+	}
+
 	go func() {
-		ticker := time.NewTicker(10 * time.Minute)
+		ticker := time.NewTicker(utils.DurationEnv("SESSION_CLEANUP_INTERVAL", 10*time.Minute))
 		defer ticker.Stop()
 		for {
 			select {
@@ -33,45 +57,106 @@ func main() {
 		}
 	}()
 
-	r := mux.NewRouter()
+	go func() {
+		ticker := time.NewTicker(utils.DurationEnv("SESSION_ARCHIVE_INTERVAL", time.Hour))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				handlers.ArchiveOldSessions()
+			}
+		}
+	}()
+
+	go func() {
+		dryRun := utils.BoolEnv("RETENTION_DRY_RUN", false)
+		ticker := time.NewTicker(utils.DurationEnv("RETENTION_PURGE_INTERVAL", 24*time.Hour))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				handlers.PurgeExpiredSessions(dryRun)
+			}
+		}
+	}()
 
-	r.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusOK)
-				return
+	go func() {
+		batch := utils.IntEnv("MESSAGE_KEY_ROTATION_BATCH", 500)
+		ticker := time.NewTicker(utils.DurationEnv("MESSAGE_KEY_ROTATION_INTERVAL", 10*time.Minute))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				handlers.RotateMessageKeys(batch)
 			}
-			next.ServeHTTP(w, r)
-		})
-	})
+		}
+	}()
+
+	r := mux.NewRouter()
+
+	r.Use(handlers.CORSMiddleware)
+
+	auth := func(h http.HandlerFunc) http.Handler {
+		return handlers.AuthMiddleware(h)
+	}
+	can := func(perm utils.Permission, h http.HandlerFunc) http.Handler {
+		return handlers.AuthMiddleware(handlers.RequirePermission(perm)(h))
+	}
+
+	r.HandleFunc("/api/auth/refresh", handlers.RefreshTokenHandler).Methods("POST", "OPTIONS")
 
 	r.HandleFunc("/api/user/register", handlers.UserRegisterHandler).Methods("POST", "OPTIONS")
 	r.HandleFunc("/api/user/login", handlers.UserLoginHandler).Methods("POST", "OPTIONS")
-	r.HandleFunc("/api/user/{userId}", handlers.GetUserInfoHandler).Methods("GET", "OPTIONS")
+	r.Handle("/api/user/{userId}", auth(handlers.GetUserInfoHandler)).Methods("GET", "OPTIONS")
 
-	r.HandleFunc("/api/agent/register", handlers.AgentRegisterHandler).Methods("POST", "OPTIONS")
+	r.Handle("/api/agent/register", can(utils.PermAgentManage, handlers.AgentRegisterHandler)).Methods("POST", "OPTIONS")
 	r.HandleFunc("/api/agent/login", handlers.AgentLoginHandler).Methods("POST", "OPTIONS")
-	r.HandleFunc("/api/agent/status", handlers.AgentStatusHandler).Methods("POST", "OPTIONS")
-	r.HandleFunc("/api/agent/active-sessions/{agentId}", handlers.GetAgentActiveSessionsHandler).Methods("GET", "OPTIONS")
-	r.HandleFunc("/api/agent/takeover", handlers.TakeOverAISessionHandler).Methods("POST", "OPTIONS")
-	r.HandleFunc("/api/agent/assign-session", handlers.AssignSessionToAgentHandler).Methods("POST", "OPTIONS")
-	r.HandleFunc("/api/agent/send", handlers.SendHandler).Methods("POST", "OPTIONS")
-
-	r.HandleFunc("/api/session/start", handlers.StartSessionHandler).Methods("POST", "OPTIONS")
-	r.HandleFunc("/api/session/info", handlers.GetSessionInfoHandler).Methods("GET", "OPTIONS")
-	r.HandleFunc("/api/session/end", handlers.EndSessionHandler).Methods("POST", "OPTIONS")
-	r.HandleFunc("/api/session/transfer", handlers.TransferToAgentHandler).Methods("POST", "OPTIONS")
-	r.HandleFunc("/api/session/messages", handlers.SessionMessagesGetHandler).Methods("GET", "OPTIONS")
-	r.HandleFunc("/api/session/agent/{agentId}", handlers.GetAgentSessionsHandler).Methods("GET", "OPTIONS")
-	r.HandleFunc("/api/session/user/active", handlers.GetUserActiveSessionHandler).Methods("GET", "OPTIONS")
-	r.HandleFunc("/api/session/user/{userId}", handlers.GetUserSessionsHandler).Methods("GET", "OPTIONS")
-
-	r.HandleFunc("/api/chat", handlers.ChatHandler).Methods("POST", "OPTIONS")
-
-	r.HandleFunc("/api/sessions/ai", handlers.GetAISessionsHandler).Methods("GET", "OPTIONS")
+	r.Handle("/api/agent/status", can(utils.PermAgentStatus, handlers.AgentStatusHandler)).Methods("POST", "OPTIONS")
+	r.Handle("/api/agent/active-sessions/{agentId}", can(utils.PermSessionQueue, handlers.GetAgentActiveSessionsHandler)).Methods("GET", "OPTIONS")
+	r.Handle("/api/agent/takeover", can(utils.PermSessionClaim, handlers.TakeOverAISessionHandler)).Methods("POST", "OPTIONS")
+	r.Handle("/api/agent/assign-session", can(utils.PermSessionClaim, handlers.AssignSessionToAgentHandler)).Methods("POST", "OPTIONS")
+	r.Handle("/api/agent/send", can(utils.PermSessionQueue, handlers.SendHandler)).Methods("POST", "OPTIONS")
+
+	r.Handle("/api/session/start", can(utils.PermSessionStart, handlers.StartSessionHandler)).Methods("POST", "OPTIONS")
+	r.Handle("/api/session/info", can(utils.PermSessionAccess, handlers.GetSessionInfoHandler)).Methods("GET", "OPTIONS")
+	r.Handle("/api/session/events", can(utils.PermSessionAudit, handlers.GetSessionEventsHandler)).Methods("GET", "OPTIONS")
+	r.Handle("/api/session/end", can(utils.PermSessionAccess, handlers.EndSessionHandler)).Methods("POST", "OPTIONS")
+	r.Handle("/api/session/transfer", can(utils.PermSessionAccess, handlers.TransferToAgentHandler)).Methods("POST", "OPTIONS")
+	r.Handle("/api/session/messages", can(utils.PermSessionAccess, handlers.SessionMessagesGetHandler)).Methods("GET", "OPTIONS")
+	r.Handle("/api/session/messages/original", can(utils.PermPIIView, handlers.GetOriginalMessageHandler)).Methods("GET", "OPTIONS")
+	r.Handle("/api/session/agent/{agentId}", can(utils.PermSessionQueue, handlers.GetAgentSessionsHandler)).Methods("GET", "OPTIONS")
+	r.Handle("/api/session/user/active", can(utils.PermSessionAccess, handlers.GetUserActiveSessionHandler)).Methods("GET", "OPTIONS")
+	r.Handle("/api/session/user/{userId}", can(utils.PermSessionAccess, handlers.GetUserSessionsHandler)).Methods("GET", "OPTIONS")
+
+	r.Handle("/api/chat", can(utils.PermChat, handlers.ChatHandler)).Methods("POST", "OPTIONS")
+
+	r.Handle("/api/sessions/ai", can(utils.PermSessionQueue, handlers.GetAISessionsHandler)).Methods("GET", "OPTIONS")
+
+	r.Handle("/api/supervisor/agents", can(utils.PermAgentViewAll, handlers.ListAgentsHandler)).Methods("GET", "OPTIONS")
+	r.Handle("/api/supervisor/agents/capacity", can(utils.PermAgentCapacity, handlers.SetAgentCapacityHandler)).Methods("POST", "OPTIONS")
+	r.Handle("/api/supervisor/agents/skills", can(utils.PermAgentSkills, handlers.SetAgentSkillsHandler)).Methods("POST", "OPTIONS")
+	r.Handle("/api/supervisor/reassign", can(utils.PermSessionReassign, handlers.ReassignSessionHandler)).Methods("POST", "OPTIONS")
+	r.Handle("/api/supervisor/end-session", can(utils.PermSessionEndAny, handlers.EndSessionHandler)).Methods("POST", "OPTIONS")
+
+	r.Handle("/api/admin/agents/role", can(utils.PermRoleManage, handlers.SetAgentRoleHandler)).Methods("POST", "OPTIONS")
+	r.Handle("/api/admin/prompts", can(utils.PermPromptManage, handlers.ListPromptTemplatesHandler)).Methods("GET", "OPTIONS")
+	r.Handle("/api/admin/prompts", can(utils.PermPromptManage, handlers.SavePromptTemplateHandler)).Methods("PUT")
+	r.Handle("/api/admin/prompts", can(utils.PermPromptManage, handlers.DeletePromptTemplateHandler)).Methods("DELETE")
+	r.Handle("/api/admin/prompts/preview", can(utils.PermPromptManage, handlers.PreviewPromptHandler)).Methods("GET", "OPTIONS")
+	r.Handle("/api/admin/retention/policies", can(utils.PermRetentionManage, handlers.ListRetentionPoliciesHandler)).Methods("GET", "OPTIONS")
+	r.Handle("/api/admin/retention/policies", can(utils.PermRetentionManage, handlers.SaveRetentionPolicyHandler)).Methods("PUT")
+	r.Handle("/api/admin/retention/policies", can(utils.PermRetentionManage, handlers.DeleteRetentionPolicyHandler)).Methods("DELETE")
+	r.Handle("/api/admin/retention/purge", can(utils.PermRetentionManage, handlers.PurgeSessionsHandler)).Methods("POST", "OPTIONS")
+	r.Handle("/api/admin/legal-hold", can(utils.PermRetentionManage, handlers.LegalHoldHandler)).Methods("POST", "OPTIONS")
+	r.Handle("/api/privacy/export", auth(handlers.ExportUserDataHandler)).Methods("GET", "OPTIONS")
+	r.Handle("/api/privacy/erase", auth(handlers.EraseUserDataHandler)).Methods("POST", "OPTIONS")
+
+	r.Handle("/api/kb/articles", can(utils.PermKnowledgeManage, handlers.ListArticlesHandler)).Methods("GET", "OPTIONS")
+	r.Handle("/api/kb/articles", can(utils.PermKnowledgeManage, handlers.CreateArticleHandler)).Methods("POST")
+	r.Handle("/api/kb/articles/{articleId}", can(utils.PermKnowledgeManage, handlers.GetArticleHandler)).Methods("GET", "OPTIONS")
+	r.Handle("/api/kb/articles/{articleId}", can(utils.PermKnowledgeManage, handlers.DeleteArticleHandler)).Methods("DELETE")
+	r.Handle("/api/kb/reindex", can(utils.PermKnowledgeManage, handlers.ReindexArticlesHandler)).Methods("POST", "OPTIONS")
+	r.Handle("/api/kb/search", can(utils.PermSessionQueue, handlers.SearchKnowledgeHandler)).Methods("GET", "OPTIONS")
 
 	r.HandleFunc("/ws", websocket.HandleWebSocket)
 
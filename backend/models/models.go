@@ -5,28 +5,138 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 type Agent struct{
-	ID        primitive.ObjectID `bson:"_id,omitempty"`
-	Name      string             `bson:"name"`
-	Email     string             `bson:"email"`
-	Password  string             `bson:"password"`
-	Status    string             `bson:"status"`
-	CreatedAt time.Time          `bson:"created_at"`
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	Name           string             `bson:"name"`
+	Email          string             `bson:"email"`
+	Password       string             `bson:"password" json:"-"`
+	Status         string             `bson:"status"`
+	Role           string             `bson:"role,omitempty"`
+	Presence       string             `bson:"presence,omitempty"`
+	LastSeen       time.Time          `bson:"lastSeen,omitempty"`
+	LastAssignedAt time.Time          `bson:"lastAssignedAt,omitempty"`
+	MaxConcurrent  int                `bson:"maxConcurrent,omitempty"`
+	ActiveSessions int                `bson:"activeSessions,omitempty"`
+	Skills         []string           `bson:"skills,omitempty"`
+	Languages      []string           `bson:"languages,omitempty"`
+	CreatedAt      time.Time          `bson:"created_at"`
 }
 
 type Session struct {
-    ID             primitive.ObjectID `bson:"_id,omitempty" json:"sessionId"`
-    UserID         string             `bson:"userId"          json:"userId"`
-    AssignedAgent  string             `bson:"assignedAgent"   json:"assignedAgent"`
-    Mode           string             `bson:"mode"            json:"mode"`
-    Status         string             `bson:"status"          json:"status"`
-    CreatedAt      time.Time          `bson:"createdAt"       json:"createdAt"`
-    LastActivity   time.Time          `bson:"lastActivity"    json:"lastActivity"`
+    ID                 primitive.ObjectID `bson:"_id,omitempty" json:"sessionId"`
+    UserID             string             `bson:"userId"          json:"userId"`
+    AssignedAgent      string             `bson:"assignedAgent"   json:"assignedAgent"`
+    Mode               string             `bson:"mode"            json:"mode"`
+    Status             string             `bson:"status"          json:"status"`
+    CreatedAt          time.Time          `bson:"createdAt"       json:"createdAt"`
+    LastActivity       time.Time          `bson:"lastActivity"    json:"lastActivity"`
+    LastSeq            int64              `bson:"lastSeq,omitempty" json:"lastSeq"`
+    Tenant             string             `bson:"tenant,omitempty"  json:"tenant,omitempty"`
+    Channel            string             `bson:"channel,omitempty" json:"channel,omitempty"`
+    EscalationReason   string             `bson:"escalationReason,omitempty"   json:"escalationReason,omitempty"`
+    EscalatedAt        time.Time          `bson:"escalatedAt,omitempty"        json:"escalatedAt,omitempty"`
+    LowConfidenceCount int                `bson:"lowConfidenceCount,omitempty" json:"-"`
+    QueuedAt           time.Time          `bson:"queuedAt,omitempty"           json:"queuedAt,omitempty"`
+    RequiredSkill      string             `bson:"requiredSkill,omitempty"      json:"requiredSkill,omitempty"`
+    Language           string             `bson:"language,omitempty"           json:"language,omitempty"`
+    ClosedReason       string             `bson:"closedReason,omitempty"       json:"closedReason,omitempty"`
+    ClosedAt           time.Time          `bson:"closedAt,omitempty"           json:"closedAt,omitempty"`
+    LegalHold          bool               `bson:"legalHold,omitempty"          json:"legalHold,omitempty"`
+}
+
+type SessionEvent struct {
+    ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    SessionID primitive.ObjectID `bson:"sessionId"     json:"sessionId"`
+    From      string             `bson:"from"          json:"from"`
+    To        string             `bson:"to"            json:"to"`
+    Actor     string             `bson:"actor"         json:"actor"`
+    Reason    string             `bson:"reason"        json:"reason"`
+    Agent     string             `bson:"agent"         json:"agent"`
+    At        time.Time          `bson:"at"            json:"at"`
+}
+
+type RetentionPolicy struct {
+    ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    Tenant     string             `bson:"tenant"        json:"tenant"`
+    Mode       string             `bson:"mode"          json:"mode"`
+    Status     string             `bson:"status"        json:"status"`
+    RetainDays int                `bson:"retainDays"    json:"retainDays"`
+    UpdatedAt  time.Time          `bson:"updatedAt"     json:"updatedAt"`
+    UpdatedBy  string             `bson:"updatedBy"     json:"updatedBy"`
+}
+
+type ComplianceRecord struct {
+    ID          primitive.ObjectID `bson:"_id,omitempty"         json:"id"`
+    Type        string             `bson:"type"                  json:"type"`
+    SubjectHash string             `bson:"subjectHash"           json:"subjectHash"`
+    Pseudonym   string             `bson:"pseudonym,omitempty"   json:"pseudonym,omitempty"`
+    RequestedBy string             `bson:"requestedBy"           json:"requestedBy"`
+    Format      string             `bson:"format,omitempty"      json:"format,omitempty"`
+    Outcome     string             `bson:"outcome"               json:"outcome"`
+    Detail      string             `bson:"detail,omitempty"      json:"detail,omitempty"`
+    Counts      map[string]int64   `bson:"counts,omitempty"      json:"counts,omitempty"`
+    At          time.Time          `bson:"at"                    json:"at"`
 }
 
 type Message struct {
     ID        primitive.ObjectID `bson:"_id,omitempty"`
     SessionID primitive.ObjectID `bson:"sessionId"`
+    Seq       int64              `bson:"seq"`
+    Sender    string             `bson:"sender"`
+    Text      string             `bson:"text"`
+    Timestamp time.Time          `bson:"timestamp"`
+    Citations []string           `bson:"citations,omitempty"`
+    PII       []string           `bson:"pii,omitempty"`
+    Enc       *EncryptedText     `bson:"enc,omitempty" json:"-"`
+}
+
+type ConversationEntry struct {
+    ID        primitive.ObjectID `bson:"_id,omitempty"`
     Sender    string             `bson:"sender"`
     Text      string             `bson:"text"`
     Timestamp time.Time          `bson:"timestamp"`
-}
\ No newline at end of file
+    PII       []string           `bson:"pii,omitempty"`
+    Enc       *EncryptedText     `bson:"enc,omitempty" json:"-"`
+}
+
+type EncryptedText struct {
+    KeyID string `bson:"kek"`
+    DEK   []byte `bson:"dek"`
+    Data  []byte `bson:"data"`
+}
+
+type PromptTemplate struct {
+    ID              primitive.ObjectID `bson:"_id,omitempty"    json:"id"`
+    Tenant          string             `bson:"tenant"           json:"tenant"`
+    Channel         string             `bson:"channel"          json:"channel"`
+    Company         string             `bson:"company"          json:"company"`
+    Persona         string             `bson:"persona"          json:"persona"`
+    Tone            string             `bson:"tone"             json:"tone"`
+    Language        string             `bson:"language"         json:"language"`
+    ForbiddenTopics []string           `bson:"forbiddenTopics"  json:"forbiddenTopics"`
+    Facts           []string           `bson:"facts"            json:"facts"`
+    Instructions    string             `bson:"instructions"     json:"instructions"`
+    UpdatedAt       time.Time          `bson:"updatedAt"        json:"updatedAt"`
+    UpdatedBy       string             `bson:"updatedBy"        json:"updatedBy"`
+}
+
+type KBArticle struct {
+    ID         primitive.ObjectID `bson:"_id,omitempty"  json:"id"`
+    Title      string             `bson:"title"          json:"title"`
+    Format     string             `bson:"format"         json:"format"`
+    Source     string             `bson:"source"         json:"source,omitempty"`
+    Tags       []string           `bson:"tags"           json:"tags"`
+    ChunkCount int                `bson:"chunkCount"     json:"chunkCount"`
+    Embedder   string             `bson:"embedder"       json:"embedder"`
+    CreatedBy  string             `bson:"createdBy"      json:"createdBy"`
+    CreatedAt  time.Time          `bson:"createdAt"      json:"createdAt"`
+    UpdatedAt  time.Time          `bson:"updatedAt"      json:"updatedAt"`
+}
+
+type KBChunk struct {
+    ID        primitive.ObjectID `bson:"_id,omitempty"`
+    ArticleID primitive.ObjectID `bson:"articleId"`
+    Index     int                `bson:"index"`
+    Text      string             `bson:"text"`
+    Embedder  string             `bson:"embedder"`
+    Vector    []float32          `bson:"vector"`
+}
@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Why a session was closed, stored as its closedReason.
+const (
+	CloseEnded     = "ended"
+	CloseAbandoned = "abandoned"
+	CloseTimeout   = "timeout"
+	CloseDuplicate = "duplicate"
+	CloseErased    = "erased"
+)
+
+type archiveConfig struct {
+	idleSystem   time.Duration
+	idleHuman    time.Duration
+	archiveAfter time.Duration
+	batch        int
+}
+
+var (
+	archiveOnce sync.Once
+	archiving   archiveConfig
+)
+
+func archiveSettings() archiveConfig {
+	archiveOnce.Do(func() {
+		archiving.idleSystem = DurationEnv("SESSION_IDLE_TIMEOUT_SYSTEM", 30*time.Minute)
+		archiving.idleHuman = DurationEnv("SESSION_IDLE_TIMEOUT_HUMAN", 30*time.Minute)
+		archiving.archiveAfter = DurationEnv("SESSION_ARCHIVE_AFTER", 30*24*time.Hour)
+		archiving.batch = IntEnv("SESSION_ARCHIVE_BATCH", 100)
+	})
+	return archiving
+}
+
+func SessionArchiveColl() *mongo.Collection {
+	return MongoDB.Collection("sessions_archive")
+}
+
+func MessageArchiveColl() *mongo.Collection {
+	return MongoDB.Collection("messages_archive")
+}
+
+// CloseSession completes a session the way it was last seen, records why and
+// frees its agent's slot. It reports false if the session changed in the
+// meantime.
+func CloseSession(ctx context.Context, seen models.Session, actor, reason string) (bool, error) {
+	_, ok, err := TransitionSession(ctx, seen, Transition{
+		To:     StateCompleted,
+		Actor:  actor,
+		Reason: reason,
+		Set:    bson.M{"closedReason": reason, "closedAt": time.Now()},
+	})
+	if err != nil || !ok {
+		return false, err
+	}
+	if seen.Mode == ModeHuman {
+		ReleaseAgentByID(ctx, seen.AssignedAgent)
+	}
+	return true, nil
+}
+
+// CloseIdleSessions closes open sessions nobody has written to for longer
+// than their mode's idle timeout: AI and queued sessions the customer walked
+// away from as abandoned, agent sessions as timed out. Queued customers who
+// are still connected are waiting, not gone, and are left in the queue. It
+// returns the sessions it closed.
+func CloseIdleSessions(ctx context.Context) ([]models.Session, error) {
+	cfg := archiveSettings()
+	now := time.Now()
+	rules := []struct {
+		state         string
+		idle          time.Duration
+		reason        string
+		keepConnected bool
+	}{
+		{StateAI, cfg.idleSystem, CloseAbandoned, false},
+		{StateQueued, cfg.idleSystem, CloseAbandoned, true},
+		{StateAgent, cfg.idleHuman, CloseTimeout, false},
+	}
+
+	var closed []models.Session
+	for _, rule := range rules {
+		filter := stateFilter(rule.state)
+		filter["lastActivity"] = bson.M{"$lt": now.Add(-rule.idle)}
+		cursor, err := SessionColl.Find(ctx, filter)
+		if err != nil {
+			return closed, err
+		}
+		var sessions []models.Session
+		err = cursor.All(ctx, &sessions)
+		if err != nil {
+			return closed, err
+		}
+		for _, s := range sessions {
+			if rule.keepConnected && customerConnected(ctx, s.UserID) {
+				continue
+			}
+			ok, err := CloseSession(ctx, s, ActorSystem, rule.reason)
+			if err != nil {
+				log.Printf("[CLEANUP][ERROR] Failed to close session %s: %v", s.ID.Hex(), err)
+				continue
+			}
+			if ok {
+				closed = append(closed, s)
+			}
+		}
+	}
+	return closed, nil
+}
+
+// customerConnected reports whether the customer has a connection open on
+// any instance, going by the presence stored on their account.
+func customerConnected(ctx context.Context, userID string) bool {
+	var user struct {
+		Presence string `bson:"presence"`
+	}
+	err := MongoDB.Collection("users").FindOne(ctx, bson.M{"email": userID}).Decode(&user)
+	return err == nil && user.Presence != "" && user.Presence != "offline"
+}
+
+// ArchiveSessions moves sessions completed more than SESSION_ARCHIVE_AFTER
+// ago, with their messages, to the archive collections. A session is first
+// marked archiving, which stops it taking messages; copies are upserts and
+// only what was copied is deleted, so a run that fails half way is simply
+// finished by the next one.
+func ArchiveSessions(ctx context.Context) (int, error) {
+	cfg := archiveSettings()
+	cursor, err := SessionColl.Find(ctx,
+		bson.M{"$or": bson.A{
+			bson.M{"status": StatusCompleted, "lastActivity": bson.M{"$lt": time.Now().Add(-cfg.archiveAfter)}},
+			bson.M{"status": StatusArchiving},
+		}},
+		options.Find().SetLimit(int64(cfg.batch)),
+	)
+	if err != nil {
+		return 0, err
+	}
+	var sessions []bson.M
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return 0, err
+	}
+
+	archived := 0
+	for _, doc := range sessions {
+		id, ok := doc["_id"].(primitive.ObjectID)
+		if !ok {
+			continue
+		}
+		done, err := archiveSession(ctx, id, doc)
+		if err != nil {
+			log.Printf("[ARCHIVE][ERROR] Failed to archive session %s: %v", id.Hex(), err)
+			continue
+		}
+		if done {
+			archived++
+		}
+	}
+	return archived, nil
+}
+
+// archiveSession reports whether the session was archived. It reports false
+// when the session changed before it could be marked, or when messages that
+// were already being written landed after the copy; those are picked up by
+// the next run.
+func archiveSession(ctx context.Context, id primitive.ObjectID, doc bson.M) (bool, error) {
+	agent, _ := doc["assignedAgent"].(string)
+	if doc["status"] == StatusCompleted {
+		res, err := SessionColl.UpdateOne(ctx,
+			bson.M{"_id": id, "status": StatusCompleted},
+			bson.M{"$set": bson.M{"status": StatusArchiving}},
+		)
+		if err != nil {
+			return false, err
+		}
+		if res.ModifiedCount == 0 {
+			return false, nil
+		}
+		recordTransition(ctx, models.Session{ID: id, AssignedAgent: agent}, StateCompleted, StateArchiving, ActorSystem, "archival")
+	}
+
+	cursor, err := MessageColl.Find(ctx, bson.M{"sessionId": id})
+	if err != nil {
+		return false, err
+	}
+	var messages []bson.M
+	if err := cursor.All(ctx, &messages); err != nil {
+		return false, err
+	}
+	if len(messages) > 0 {
+		writes := make([]mongo.WriteModel, 0, len(messages))
+		copied := make(bson.A, 0, len(messages))
+		for _, m := range messages {
+			writes = append(writes, mongo.NewReplaceOneModel().
+				SetFilter(bson.M{"_id": m["_id"]}).SetReplacement(m).SetUpsert(true))
+			copied = append(copied, m["_id"])
+		}
+		if _, err := MessageArchiveColl().BulkWrite(ctx, writes); err != nil {
+			return false, err
+		}
+		if _, err := MessageColl.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": copied}}); err != nil {
+			return false, err
+		}
+	}
+	if n, err := MessageColl.CountDocuments(ctx, bson.M{"sessionId": id}); err != nil || n > 0 {
+		return false, err
+	}
+
+	// The archived copy keeps the status the session was completed with.
+	doc["status"] = StatusCompleted
+	doc["archivedAt"] = time.Now()
+	if _, err := SessionArchiveColl().ReplaceOne(ctx, bson.M{"_id": id}, doc, options.Replace().SetUpsert(true)); err != nil {
+		return false, err
+	}
+	res, err := SessionColl.DeleteOne(ctx, bson.M{"_id": id, "status": StatusArchiving})
+	if err != nil {
+		return false, err
+	}
+	if res.DeletedCount == 1 {
+		recordTransition(ctx, models.Session{ID: id, AssignedAgent: agent}, StateArchiving, StateArchived, ActorSystem, "archival")
+	}
+	return res.DeletedCount == 1, nil
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseToken(t *testing.T) {
+	initAuth()
+	p := Principal{ID: "agent-1", Email: "agent@example.com", Role: RoleAgent}
+
+	issue := func(tokenType string, ttl time.Duration) string {
+		token, err := signToken(p, tokenType, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	access := issue(TokenTypeAccess, time.Minute)
+	parts := strings.Split(access, ".")
+
+	otherSecret := func() string {
+		saved := authSecret
+		authSecret = []byte("some other secret")
+		defer func() { authSecret = saved }()
+		return issue(TokenTypeAccess, time.Minute)
+	}()
+
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin-1","role":"admin","typ":"access","exp":9999999999}`))
+
+	tests := []struct {
+		name      string
+		token     string
+		tokenType string
+		want      error
+	}{
+		{"valid access token", access, TokenTypeAccess, nil},
+		{"valid refresh token", issue(TokenTypeRefresh, time.Minute), TokenTypeRefresh, nil},
+		{"refresh token used as access token", issue(TokenTypeRefresh, time.Minute), TokenTypeAccess, ErrInvalidToken},
+		{"expired", issue(TokenTypeAccess, -time.Second), TokenTypeAccess, ErrExpiredToken},
+		{"expires now", issue(TokenTypeAccess, 0), TokenTypeAccess, ErrExpiredToken},
+		{"signed with another secret", otherSecret, TokenTypeAccess, ErrInvalidToken},
+		{"payload swapped", parts[0] + "." + tampered + "." + parts[2], TokenTypeAccess, ErrInvalidToken},
+		{"signature removed", parts[0] + "." + parts[1] + ".", TokenTypeAccess, ErrInvalidToken},
+		{"signature not base64", parts[0] + "." + parts[1] + ".!!!", TokenTypeAccess, ErrInvalidToken},
+		{"too few parts", parts[0] + "." + parts[1], TokenTypeAccess, ErrInvalidToken},
+		{"empty", "", TokenTypeAccess, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseToken(tt.token, tt.tokenType)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ParseToken() error = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && *got != p {
+				t.Errorf("ParseToken() = %+v, want %+v", *got, p)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SeedBootstrapAdmin creates the first admin from BOOTSTRAP_ADMIN_EMAIL and
+// BOOTSTRAP_ADMIN_PASSWORD at startup. Staff registration is admin-only, so
+// this is the only way in for a fresh install. An existing account with that
+// email is left as it is rather than promoted: whoever created it did so
+// without the password from the environment.
+func SeedBootstrapAdmin(ctx context.Context) error {
+	email := strings.TrimSpace(os.Getenv("BOOTSTRAP_ADMIN_EMAIL"))
+	if email == "" {
+		return nil
+	}
+
+	err := AgentColl.FindOne(ctx, bson.M{"email": email}).Err()
+	if err == nil {
+		log.Printf("[AUTH] Bootstrap admin %s already exists, leaving it unchanged", email)
+		return nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	password := os.Getenv("BOOTSTRAP_ADMIN_PASSWORD")
+	if len(password) < 12 {
+		return fmt.Errorf("BOOTSTRAP_ADMIN_PASSWORD must be at least 12 characters to create %s", email)
+	}
+	hashed, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = AgentColl.InsertOne(ctx, bson.M{
+		"name":      "Admin",
+		"email":     email,
+		"password":  hashed,
+		"role":      RoleAdmin,
+		"status":    "offline",
+		"createdAt": time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("[AUTH] Created bootstrap admin %s", email)
+	return nil
+}
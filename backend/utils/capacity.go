@@ -0,0 +1,215 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// An agent's activeSessions counts the human sessions assigned to them and
+// is only ever changed with $inc-style pipeline updates, so concurrent
+// assignments cannot lose a count. Their status follows from it: while they
+// are working an agent is available below capacity and busy at capacity.
+// away and offline come from presence or the agent and are left alone.
+
+var (
+	capacityOnce         sync.Once
+	defaultMaxConcurrent int
+)
+
+func DefaultMaxConcurrent() int {
+	capacityOnce.Do(func() {
+		defaultMaxConcurrent = IntEnv("AGENT_MAX_CONCURRENT", 3)
+		if defaultMaxConcurrent < 1 {
+			defaultMaxConcurrent = 1
+		}
+	})
+	return defaultMaxConcurrent
+}
+
+// AgentCapacity resolves the maxConcurrent stored on an agent, zero meaning
+// the default.
+func AgentCapacity(maxConcurrent int) int {
+	if maxConcurrent > 0 {
+		return maxConcurrent
+	}
+	return DefaultMaxConcurrent()
+}
+
+func capacityExpr() bson.M {
+	return bson.M{"$ifNull": bson.A{"$maxConcurrent", DefaultMaxConcurrent()}}
+}
+
+func loadExpr() bson.M {
+	return bson.M{"$ifNull": bson.A{"$activeSessions", 0}}
+}
+
+func workingStatus(load interface{}) bson.M {
+	return bson.M{"$cond": bson.A{bson.M{"$lt": bson.A{load, capacityExpr()}}, "available", "busy"}}
+}
+
+// derivedStatus recomputes the status for a new load unless the agent is
+// away or offline. An agent kept busy after going away or disconnecting
+// takes on that presence once they have a free slot again, so nothing is
+// dispatched to them.
+func derivedStatus(load interface{}) bson.M {
+	return bson.M{"$cond": bson.A{
+		bson.M{"$in": bson.A{"$status", bson.A{"available", "busy"}}},
+		bson.M{"$cond": bson.A{
+			bson.M{"$and": bson.A{
+				bson.M{"$lt": bson.A{load, capacityExpr()}},
+				bson.M{"$in": bson.A{"$presence", bson.A{"away", "offline"}}},
+			}},
+			"$presence",
+			workingStatus(load),
+		}},
+		"$status",
+	}}
+}
+
+// ClaimAgent takes one of an available agent's free slots. Only as many
+// callers as there are free slots can win, so it is the first step of every
+// assignment.
+func ClaimAgent(ctx context.Context, agentID primitive.ObjectID) (bool, error) {
+	next := bson.M{"$add": bson.A{loadExpr(), 1}}
+	res, err := AgentColl.UpdateOne(ctx,
+		bson.M{
+			"_id":    agentID,
+			"status": "available",
+			"$expr":  bson.M{"$lt": bson.A{loadExpr(), capacityExpr()}},
+		},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"activeSessions": next,
+			"status":         workingStatus(next),
+			"lastAssignedAt": time.Now(),
+		}}}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// AddAgentLoad counts a session against an agent regardless of capacity,
+// for supervisors who assign work by hand.
+func AddAgentLoad(ctx context.Context, agentID primitive.ObjectID) error {
+	next := bson.M{"$add": bson.A{loadExpr(), 1}}
+	_, err := AgentColl.UpdateOne(ctx,
+		bson.M{"_id": agentID},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"activeSessions": next,
+			"status":         derivedStatus(next),
+			"lastAssignedAt": time.Now(),
+		}}}},
+	)
+	return err
+}
+
+// ReleaseAgent frees one of the agent's slots, when a session ends or moves
+// away or when ClaimAgent's session could not be claimed after all.
+func ReleaseAgent(ctx context.Context, agentID primitive.ObjectID) {
+	next := bson.M{"$max": bson.A{bson.M{"$subtract": bson.A{loadExpr(), 1}}, 0}}
+	AgentColl.UpdateOne(ctx,
+		bson.M{"_id": agentID},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"activeSessions": next,
+			"status":         derivedStatus(next),
+		}}}},
+	)
+}
+
+// ReleaseAgentByID is ReleaseAgent for the hex ids stored on sessions; the
+// "System" placeholder and empty ids are ignored.
+func ReleaseAgentByID(ctx context.Context, agentID string) {
+	if objID, err := primitive.ObjectIDFromHex(agentID); err == nil {
+		ReleaseAgent(ctx, objID)
+	}
+}
+
+// MarkAgentWorking sets an agent available or busy according to their load.
+// With from, only an agent currently in one of those statuses is changed.
+func MarkAgentWorking(ctx context.Context, agentID primitive.ObjectID, from ...string) (bool, error) {
+	filter := bson.M{"_id": agentID}
+	if len(from) > 0 {
+		filter["status"] = bson.M{"$in": from}
+	}
+	res, err := AgentColl.UpdateOne(ctx, filter,
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"status": workingStatus(loadExpr())}}}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// SetAgentCapacity stores an agent's maximum number of concurrent chats;
+// zero reverts to the default. The status is recomputed straight away.
+func SetAgentCapacity(ctx context.Context, agentID primitive.ObjectID, maxConcurrent int) (bool, error) {
+	var set bson.M
+	if maxConcurrent > 0 {
+		set = bson.M{"maxConcurrent": maxConcurrent}
+	} else {
+		set = bson.M{"maxConcurrent": "$$REMOVE"}
+	}
+	res, err := AgentColl.UpdateOne(ctx, bson.M{"_id": agentID}, mongo.Pipeline{
+		{{Key: "$set", Value: set}},
+		{{Key: "$set", Value: bson.M{"status": derivedStatus(loadExpr())}}},
+	})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+// ReconcileAgentLoads recounts every agent's active human sessions and
+// corrects activeSessions where it has drifted, e.g. because a session was
+// deleted rather than ended. An assignment racing with it can be off by one
+// until the next run.
+func ReconcileAgentLoads(ctx context.Context) error {
+	cursor, err := SessionColl.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"mode": "human", "status": "active"}}},
+		{{Key: "$group", Value: bson.M{"_id": "$assignedAgent", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return err
+	}
+	counts := make(map[primitive.ObjectID]int)
+	for cursor.Next(ctx) {
+		var row struct {
+			ID    string `bson:"_id"`
+			Count int    `bson:"count"`
+		}
+		if cursor.Decode(&row) != nil {
+			continue
+		}
+		if objID, err := primitive.ObjectIDFromHex(row.ID); err == nil {
+			counts[objID] = row.Count
+		}
+	}
+	cursor.Close(ctx)
+
+	agents, err := AgentColl.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer agents.Close(ctx)
+
+	for agents.Next(ctx) {
+		var a struct {
+			ID             primitive.ObjectID `bson:"_id"`
+			ActiveSessions int                `bson:"activeSessions"`
+		}
+		if agents.Decode(&a) != nil || a.ActiveSessions == counts[a.ID] {
+			continue
+		}
+		AgentColl.UpdateOne(ctx, bson.M{"_id": a.ID}, mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{"activeSessions": counts[a.ID]}}},
+			{{Key: "$set", Value: bson.M{"status": derivedStatus(loadExpr())}}},
+		})
+	}
+	return agents.Err()
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+func DurationEnv(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("[CONFIG][WARN] Invalid %s=%q, using %s", name, v, def)
+		return def
+	}
+	return d
+}
+
+func IntEnv(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("[CONFIG][WARN] Invalid %s=%q, using %d", name, v, def)
+		return def
+	}
+	return n
+}
+
+func FloatEnv(name string, def float64) float64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Printf("[CONFIG][WARN] Invalid %s=%q, using %g", name, v, def)
+		return def
+	}
+	return f
+}
+
+func BoolEnv(name string, def bool) bool {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("[CONFIG][WARN] Invalid %s=%q, using %t", name, v, def)
+		return def
+	}
+	return b
+}
@@ -0,0 +1,241 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Conversations saved by /api/chat and /api/agent/send keep their messages
+// inline, in one document in messages, under "conversation" and "messages"
+// respectively, rather than in a session. Every inline message still gets an
+// ID of its own, so it can be vaulted and encrypted like a session message.
+// Records written before that have messages without IDs; rotation gives them
+// one when it encrypts them.
+
+var conversationFields = []string{"conversation", "messages"}
+
+// InsertConversation stores doc with entries under field and returns its
+// ID. Each entry is treated like InsertSessionMessage treats a message: the
+// kinds of personal data in it are noted, with PII_REDACT_STORED its stored
+// text is masked and the original goes to the vault, and with MESSAGE_KEKS
+// the stored text is encrypted.
+func InsertConversation(ctx context.Context, doc bson.M, field string, entries []models.ConversationEntry) (primitive.ObjectID, error) {
+	id := primitive.NewObjectID()
+	stored := make([]models.ConversationEntry, 0, len(entries))
+	for _, e := range entries {
+		e.ID = primitive.NewObjectID()
+		masked, kinds := RedactPII(e.Text)
+		e.PII = kinds
+		if len(kinds) > 0 && piiSettings().redactStored {
+			vaulted, err := textFields(e.ID, e.Text)
+			if err != nil {
+				return id, err
+			}
+			vaulted["_id"], vaulted["conversationId"], vaulted["at"] = e.ID, id, time.Now()
+			if _, err := PIIVaultColl().InsertOne(ctx, vaulted); err != nil {
+				return id, err
+			}
+			e.Text = masked
+		}
+		if err := sealEntry(&e); err != nil {
+			return id, err
+		}
+		stored = append(stored, e)
+	}
+
+	doc["_id"] = id
+	doc[field] = stored
+	_, err := MessageColl.InsertOne(ctx, doc)
+	return id, err
+}
+
+// conversationFilter matches the conversations among the documents in
+// messages that also match filter.
+func conversationFilter(filter bson.M) bson.M {
+	stored := bson.A{}
+	for _, field := range conversationFields {
+		stored = append(stored, bson.M{field: bson.M{"$type": "array"}})
+	}
+	and := bson.A{bson.M{"$or": stored}}
+	out := bson.M{"sessionId": bson.M{"$exists": false}}
+	for k, v := range filter {
+		if k == "$or" {
+			and = append(and, bson.M{"$or": v})
+			continue
+		}
+		out[k] = v
+	}
+	out["$and"] = and
+	return out
+}
+
+// deleteConversations deletes the conversations matching filter with their
+// vaulted originals and returns how many there were.
+func deleteConversations(ctx context.Context, filter bson.M, dryRun bool) (int64, error) {
+	filter = conversationFilter(filter)
+	if dryRun {
+		return MessageColl.CountDocuments(ctx, filter)
+	}
+	ids, err := MessageColl.Distinct(ctx, "_id", filter)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	if _, err := PIIVaultColl().DeleteMany(ctx, bson.M{"conversationId": bson.M{"$in": ids}}); err != nil {
+		return 0, err
+	}
+	res, err := MessageColl.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// exportConversations returns a customer's conversations with the original
+// text of every message that was stored masked.
+func exportConversations(ctx context.Context, email string) ([]bson.M, error) {
+	cursor, err := MessageColl.Find(ctx, conversationFilter(bson.M{"userId": email}))
+	if err != nil {
+		return nil, err
+	}
+	conversations := []bson.M{}
+	if err := cursor.All(ctx, &conversations); err != nil {
+		return nil, err
+	}
+	for _, doc := range conversations {
+		originals, err := originalTexts(ctx, bson.M{"conversationId": doc["_id"]})
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range conversationFields {
+			list, ok := doc[field].(bson.A)
+			if !ok {
+				continue
+			}
+			for i, raw := range list {
+				entry, ok := raw.(bson.M)
+				if !ok {
+					continue
+				}
+				id, _ := entry["_id"].(primitive.ObjectID)
+				if enc, ok := entry["enc"].(bson.M); ok {
+					entry["text"] = openText(id, decodeEncryptedText(enc))
+					delete(entry, "enc")
+				}
+				if text, ok := originals[id]; ok {
+					entry["text"] = text
+				}
+				list[i] = entry
+			}
+		}
+	}
+	return conversations, nil
+}
+
+func sealEntry(e *models.ConversationEntry) error {
+	if keyring.active == "" {
+		return nil
+	}
+	enc, err := encryptText(e.ID, e.Text)
+	if err != nil {
+		return err
+	}
+	e.Text, e.Enc = "", enc
+	return nil
+}
+
+func decodeEncryptedText(doc bson.M) *models.EncryptedText {
+	var enc models.EncryptedText
+	if raw, err := bson.Marshal(doc); err == nil {
+		bson.Unmarshal(raw, &enc)
+	}
+	return &enc
+}
+
+// rotateConversations is RotateMessageKeys for inline messages. A
+// conversation counts as one document however many of its messages change.
+func rotateConversations(ctx context.Context, limit int) (int, error) {
+	if limit <= 0 {
+		return 0, nil
+	}
+	stale := bson.A{}
+	for _, field := range conversationFields {
+		stale = append(stale,
+			bson.M{field: bson.M{"$elemMatch": bson.M{"enc": bson.M{"$exists": false}, "text": bson.M{"$type": "string"}}}},
+			bson.M{field: bson.M{"$elemMatch": bson.M{"enc.kek": bson.M{"$exists": true, "$ne": keyring.active}}}},
+		)
+	}
+	cursor, err := MessageColl.Find(ctx, conversationFilter(bson.M{"$or": stale}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	rotated := 0
+	for rotated < limit && cursor.Next(ctx) {
+		ok, err := rotateConversation(ctx, cursor.Current)
+		if err != nil {
+			log.Printf("[CRYPTO][ERROR] Failed to rotate conversation %v: %v", cursor.Current.Lookup("_id"), err)
+			continue
+		}
+		if ok {
+			rotated++
+		}
+	}
+	return rotated, cursor.Err()
+}
+
+// rotateConversation only replaces a list of messages if it is still as it
+// was read, so it cannot undo a concurrent erasure.
+func rotateConversation(ctx context.Context, raw bson.Raw) (bool, error) {
+	var doc struct {
+		ID           primitive.ObjectID         `bson:"_id"`
+		Conversation []models.ConversationEntry `bson:"conversation"`
+		Messages     []models.ConversationEntry `bson:"messages"`
+	}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return false, err
+	}
+
+	filter, set := bson.M{"_id": doc.ID}, bson.M{}
+	for field, entries := range map[string][]models.ConversationEntry{"conversation": doc.Conversation, "messages": doc.Messages} {
+		changed := false
+		for i := range entries {
+			e := &entries[i]
+			switch {
+			case e.Enc == nil:
+				if e.ID.IsZero() {
+					e.ID = primitive.NewObjectID()
+				}
+				if err := sealEntry(e); err != nil {
+					return false, err
+				}
+				changed = true
+			case e.Enc.KeyID != keyring.active:
+				wrapped, err := rewrapKey(e.Enc)
+				if err != nil {
+					return false, err
+				}
+				e.Enc.KeyID, e.Enc.DEK = keyring.active, wrapped
+				changed = true
+			}
+		}
+		if changed {
+			filter[field] = raw.Lookup(field)
+			set[field] = entries
+		}
+	}
+	if len(set) == 0 {
+		return false, nil
+	}
+	res, err := MessageColl.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
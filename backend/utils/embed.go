@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Embedder turns texts into vectors for similarity search. Vectors from
+// different embedders are not comparable, so stored chunks remember Name().
+type Embedder interface {
+	Name() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+var Embeddings Embedder
+
+// InitEmbedder selects the embedder named by EMBEDDER: local (default), an
+// offline hashing embedder, or openai for any OpenAI-compatible /embeddings
+// endpoint.
+func InitEmbedder() error {
+	switch strings.ToLower(os.Getenv("EMBEDDER")) {
+	case "", "local":
+		Embeddings = NewHashEmbedder(IntEnv("EMBEDDING_DIMENSIONS", defaultHashDimensions))
+	case "openai":
+		model := os.Getenv("EMBEDDING_MODEL")
+		if model == "" {
+			return fmt.Errorf("EMBEDDING_MODEL is not set")
+		}
+		Embeddings = &OpenAIEmbedder{
+			BaseURL: strings.TrimRight(envOr("OPENAI_BASE_URL", "https://api.openai.com/v1"), "/"),
+			APIKey:  os.Getenv("OPENAI_API_KEY"),
+			Model:   model,
+			Client:  &http.Client{Timeout: DurationEnv("LLM_TIMEOUT", defaultLLMTimeout)},
+		}
+	default:
+		return fmt.Errorf("unknown EMBEDDER %q", os.Getenv("EMBEDDER"))
+	}
+	return nil
+}
+
+const defaultHashDimensions = 512
+
+// HashEmbedder needs no model: it hashes words and word pairs into a fixed
+// number of buckets. It only captures lexical overlap, which is enough to
+// find the article that talks about "returns" when asked about returns.
+type HashEmbedder struct {
+	dims int
+}
+
+func NewHashEmbedder(dims int) *HashEmbedder {
+	if dims <= 0 {
+		dims = defaultHashDimensions
+	}
+	return &HashEmbedder{dims: dims}
+}
+
+func (e *HashEmbedder) Name() string {
+	return fmt.Sprintf("hash-%d", e.dims)
+}
+
+func (e *HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		out[i] = e.embed(text)
+	}
+	return out, nil
+}
+
+func (e *HashEmbedder) embed(text string) []float32 {
+	vec := make([]float32, e.dims)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	add := func(feature string, weight float32) {
+		h := fnv.New32a()
+		h.Write([]byte(feature))
+		sum := h.Sum32()
+		if sum&1 == 1 {
+			weight = -weight
+		}
+		vec[int(sum>>1)%e.dims] += weight
+	}
+	for i, w := range words {
+		if len([]rune(w)) < 2 {
+			continue
+		}
+		add(w, 1)
+		if i > 0 {
+			add(words[i-1]+" "+w, 0.5)
+		}
+	}
+
+	normalize(vec)
+	return vec
+}
+
+func normalize(vec []float32) {
+	var sum float64
+	for _, v := range vec {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vec {
+		vec[i] /= norm
+	}
+}
+
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+type OpenAIEmbedder struct {
+	BaseURL string
+	APIKey  string
+	Model   string
+	Client  *http.Client
+}
+
+func (e *OpenAIEmbedder) Name() string {
+	return "openai-" + e.Model
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	jsonData, err := json.Marshal(map[string]interface{}{"model": e.Model, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.BaseURL+"/embeddings", bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.APIKey)
+	}
+
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("embeddings API error (%d): %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var out struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	if len(out.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings API returned %d vectors for %d inputs", len(out.Data), len(texts))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, d := range out.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embeddings API returned index %d out of range", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
@@ -0,0 +1,269 @@
+package utils
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Message text is stored with envelope encryption: every message gets its
+// own data key, stored next to the text wrapped by a key-encryption key (KEK)
+// from MESSAGE_KEKS. The ciphertext is bound to the document's _id, so it
+// survives archival but cannot be pasted into another message. Rotating the
+// KEK only rewraps data keys; the text itself is never re-encrypted.
+
+// UnreadableText stands in for text that cannot be decrypted, e.g. because
+// its KEK was dropped from MESSAGE_KEKS too early.
+const UnreadableText = "[unreadable]"
+
+var keyring struct {
+	active string
+	keys   map[string][]byte
+}
+
+// InitMessageEncryption reads MESSAGE_KEKS, a comma-separated list of
+// id:key pairs with base64-encoded 32-byte keys. New data keys are wrapped
+// with the first; the others are only used to read and rotate older data.
+// Without MESSAGE_KEKS message text is stored in plaintext.
+func InitMessageEncryption() error {
+	list := strings.TrimSpace(os.Getenv("MESSAGE_KEKS"))
+	if list == "" {
+		log.Println("[CRYPTO][WARN] MESSAGE_KEKS is not set, message text is stored unencrypted")
+		return nil
+	}
+
+	keys := map[string][]byte{}
+	active := ""
+	for i, entry := range strings.Split(list, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			return fmt.Errorf("MESSAGE_KEKS entry %d is not id:key", i+1)
+		}
+		if _, dup := keys[id]; dup {
+			return fmt.Errorf("MESSAGE_KEKS has key %q twice", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return fmt.Errorf("MESSAGE_KEKS key %q must be 32 bytes in base64", id)
+		}
+		keys[id] = key
+		if active == "" {
+			active = id
+		}
+	}
+	keyring.keys, keyring.active = keys, active
+	log.Printf("[CRYPTO] Encrypting message text with key %s", active)
+	return nil
+}
+
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func unseal(key, sealed, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptText encrypts the text of the document with the given ID under a
+// fresh data key.
+func encryptText(id primitive.ObjectID, text string) (*models.EncryptedText, error) {
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, err
+	}
+	data, err := seal(dek, []byte(text), id[:])
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := wrapKey(keyring.active, dek)
+	if err != nil {
+		return nil, err
+	}
+	return &models.EncryptedText{KeyID: keyring.active, DEK: wrapped, Data: data}, nil
+}
+
+func decryptText(id primitive.ObjectID, enc *models.EncryptedText) (string, error) {
+	dek, err := unwrapKey(enc)
+	if err != nil {
+		return "", err
+	}
+	text, err := unseal(dek, enc.Data, id[:])
+	if err != nil {
+		return "", err
+	}
+	return string(text), nil
+}
+
+func wrapKey(kekID string, dek []byte) ([]byte, error) {
+	return seal(keyring.keys[kekID], dek, []byte(kekID))
+}
+
+// rewrapKey returns enc's data key wrapped with the active KEK.
+func rewrapKey(enc *models.EncryptedText) ([]byte, error) {
+	dek, err := unwrapKey(enc)
+	if err != nil {
+		return nil, err
+	}
+	return wrapKey(keyring.active, dek)
+}
+
+func unwrapKey(enc *models.EncryptedText) ([]byte, error) {
+	kek, ok := keyring.keys[enc.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", enc.KeyID)
+	}
+	return unseal(kek, enc.DEK, []byte(enc.KeyID))
+}
+
+// textFields are the fields that store text for the document with the
+// given ID: the text itself, or an empty text and its encryption.
+func textFields(id primitive.ObjectID, text string) (bson.M, error) {
+	if keyring.active == "" {
+		return bson.M{"text": text}, nil
+	}
+	enc, err := encryptText(id, text)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{"text": "", "enc": enc}, nil
+}
+
+// sealMessage encrypts a message about to be stored.
+func sealMessage(msg *models.Message) error {
+	if keyring.active == "" {
+		return nil
+	}
+	enc, err := encryptText(msg.ID, msg.Text)
+	if err != nil {
+		return err
+	}
+	msg.Text, msg.Enc = "", enc
+	return nil
+}
+
+// openMessage decrypts a message just read, if it is encrypted.
+func openMessage(msg *models.Message) {
+	if msg.Enc == nil {
+		return
+	}
+	msg.Text, msg.Enc = openText(msg.ID, msg.Enc), nil
+}
+
+// openText decrypts the text of the document with the given ID, or returns
+// UnreadableText.
+func openText(id primitive.ObjectID, enc *models.EncryptedText) string {
+	text, err := decryptText(id, enc)
+	if err != nil {
+		log.Printf("[CRYPTO][ERROR] Failed to decrypt message %s: %v", id.Hex(), err)
+		return UnreadableText
+	}
+	return text
+}
+
+// RotateMessageKeys rewraps data keys that are not under the active KEK and
+// encrypts text still stored in plaintext, in messages live and archived,
+// in conversations with inline messages and in the PII vault. It stops after
+// limit documents and returns how many it updated; run it until that is zero
+// before dropping an old KEK.
+func RotateMessageKeys(ctx context.Context, limit int) (int, error) {
+	if keyring.active == "" {
+		return 0, nil
+	}
+	rotated := 0
+	for _, coll := range []*mongo.Collection{MessageColl, MessageArchiveColl(), PIIVaultColl()} {
+		cursor, err := coll.Find(ctx, bson.M{"$or": []bson.M{
+			{"enc": bson.M{"$exists": false}, "text": bson.M{"$type": "string"}},
+			{"enc.kek": bson.M{"$exists": true, "$ne": keyring.active}},
+		}})
+		if err != nil {
+			return rotated, err
+		}
+		for rotated < limit && cursor.Next(ctx) {
+			var doc struct {
+				ID   primitive.ObjectID    `bson:"_id"`
+				Text string                `bson:"text"`
+				Enc  *models.EncryptedText `bson:"enc"`
+			}
+			if err := cursor.Decode(&doc); err != nil {
+				continue
+			}
+			ok, err := rotateDocument(ctx, coll, doc.ID, doc.Text, doc.Enc)
+			if err != nil {
+				log.Printf("[CRYPTO][ERROR] Failed to rotate %s %s: %v", coll.Name(), doc.ID.Hex(), err)
+				continue
+			}
+			if ok {
+				rotated++
+			}
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil || rotated >= limit {
+			return rotated, err
+		}
+	}
+	n, err := rotateConversations(ctx, limit-rotated)
+	return rotated + n, err
+}
+
+// rotateDocument only updates the document if it is still as it was read, so
+// it cannot undo a concurrent erasure.
+func rotateDocument(ctx context.Context, coll *mongo.Collection, id primitive.ObjectID, text string, enc *models.EncryptedText) (bool, error) {
+	var filter, update bson.M
+	if enc == nil {
+		encrypted, err := encryptText(id, text)
+		if err != nil {
+			return false, err
+		}
+		filter = bson.M{"_id": id, "enc": bson.M{"$exists": false}, "text": text}
+		update = bson.M{"$set": bson.M{"text": "", "enc": encrypted}}
+	} else {
+		wrapped, err := rewrapKey(enc)
+		if err != nil {
+			return false, err
+		}
+		filter = bson.M{"_id": id, "enc.kek": enc.KeyID, "enc.dek": enc.DEK}
+		update = bson.M{"$set": bson.M{"enc.kek": keyring.active, "enc.dek": wrapped}}
+	}
+	res, err := coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
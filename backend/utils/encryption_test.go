@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"backend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(rune('a'+b)), 32)))
+}
+
+// useKeys installs MESSAGE_KEKS for the rest of the test.
+func useKeys(t *testing.T, keks string) {
+	t.Helper()
+	saved := keyring
+	t.Cleanup(func() { keyring = saved })
+	keyring.active, keyring.keys = "", nil
+	t.Setenv("MESSAGE_KEKS", keks)
+	if err := InitMessageEncryption(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInitMessageEncryption(t *testing.T) {
+	tests := []struct {
+		name       string
+		keks       string
+		wantActive string
+		wantErr    bool
+	}{
+		{"unset", "", "", false},
+		{"one key", "k1:" + testKey(1), "k1", false},
+		{"first key is active", "k2:" + testKey(2) + ", k1:" + testKey(1), "k2", false},
+		{"missing id", ":" + testKey(1), "", true},
+		{"missing key", "k1", "", true},
+		{"not base64", "k1:not-base64!", "", true},
+		{"short key", "k1:" + base64.StdEncoding.EncodeToString([]byte("short")), "", true},
+		{"duplicate id", "k1:" + testKey(1) + ",k1:" + testKey(2), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := keyring
+			defer func() { keyring = saved }()
+			keyring.active, keyring.keys = "", nil
+
+			t.Setenv("MESSAGE_KEKS", tt.keks)
+			err := InitMessageEncryption()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InitMessageEncryption() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if keyring.active != tt.wantActive {
+				t.Errorf("active key = %q, want %q", keyring.active, tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestEncryptTextRoundTrip(t *testing.T) {
+	useKeys(t, "k1:"+testKey(1))
+	id := primitive.NewObjectID()
+
+	for _, text := range []string{"", "Merhaba, siparişim nerede?", strings.Repeat("x", 4000)} {
+		enc, err := encryptText(id, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if enc.KeyID != "k1" || (text != "" && strings.Contains(string(enc.Data), text)) {
+			t.Fatalf("encryptText(%q) = %+v", text, enc)
+		}
+		got, err := decryptText(id, enc)
+		if err != nil || got != text {
+			t.Errorf("decryptText() = %q, %v, want %q", got, err, text)
+		}
+	}
+}
+
+func TestDecryptTextRejects(t *testing.T) {
+	useKeys(t, "k1:"+testKey(1)+",k2:"+testKey(2))
+	id := primitive.NewObjectID()
+	enc, err := encryptText(id, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	flip := func(b []byte) []byte {
+		out := append([]byte(nil), b...)
+		out[len(out)-1] ^= 1
+		return out
+	}
+
+	tests := []struct {
+		name string
+		id   primitive.ObjectID
+		enc  *models.EncryptedText
+	}{
+		{"another document's id", primitive.NewObjectID(), enc},
+		{"tampered data", id, &models.EncryptedText{KeyID: enc.KeyID, DEK: enc.DEK, Data: flip(enc.Data)}},
+		{"tampered data key", id, &models.EncryptedText{KeyID: enc.KeyID, DEK: flip(enc.DEK), Data: enc.Data}},
+		{"other key id", id, &models.EncryptedText{KeyID: "k2", DEK: enc.DEK, Data: enc.Data}},
+		{"unknown key id", id, &models.EncryptedText{KeyID: "k9", DEK: enc.DEK, Data: enc.Data}},
+		{"truncated", id, &models.EncryptedText{KeyID: enc.KeyID, DEK: enc.DEK, Data: enc.Data[:4]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := decryptText(tt.id, tt.enc); err == nil {
+				t.Errorf("decryptText() = %q, want an error", got)
+			}
+		})
+	}
+}
+
+func TestRewrapKeyRotation(t *testing.T) {
+	useKeys(t, "k1:"+testKey(1))
+	id := primitive.NewObjectID()
+	old, err := encryptText(id, "rotate me")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// k2 becomes active, k1 is kept to read older data.
+	useKeys(t, "k2:"+testKey(2)+",k1:"+testKey(1))
+	wrapped, err := rewrapKey(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := &models.EncryptedText{KeyID: keyring.active, DEK: wrapped, Data: old.Data}
+
+	// Once rotated, the data no longer needs k1.
+	useKeys(t, "k2:"+testKey(2))
+	if got, err := decryptText(id, rotated); err != nil || got != "rotate me" {
+		t.Errorf("decryptText() after rotation = %q, %v", got, err)
+	}
+	if _, err := decryptText(id, old); err == nil {
+		t.Error("decryptText() of the unrotated text succeeded without its key")
+	}
+	if _, err := rewrapKey(old); err == nil {
+		t.Error("rewrapKey() succeeded without the old key")
+	}
+}
+
+func TestSealAndOpenMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		sealWith string
+		openWith string
+		want     string
+		wantEnc  bool
+	}{
+		{"encryption off", "", "", "hello", false},
+		{"same key", "k1:" + testKey(1), "k1:" + testKey(1), "hello", true},
+		{"old key kept", "k1:" + testKey(1), "k2:" + testKey(2) + ",k1:" + testKey(1), "hello", true},
+		{"key dropped", "k1:" + testKey(1), "k2:" + testKey(2), UnreadableText, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useKeys(t, tt.sealWith)
+			msg := models.Message{ID: primitive.NewObjectID(), Text: "hello"}
+			if err := sealMessage(&msg); err != nil {
+				t.Fatal(err)
+			}
+			if (msg.Enc != nil) != tt.wantEnc || (tt.wantEnc && msg.Text != "") {
+				t.Fatalf("sealMessage() = %+v", msg)
+			}
+
+			entry := models.ConversationEntry{ID: primitive.NewObjectID(), Text: "hello"}
+			if err := sealEntry(&entry); err != nil {
+				t.Fatal(err)
+			}
+
+			useKeys(t, tt.openWith)
+			openMessage(&msg)
+			if msg.Text != tt.want || msg.Enc != nil {
+				t.Errorf("openMessage() = %+v, want text %q", msg, tt.want)
+			}
+			if entry.Enc != nil {
+				if got := openText(entry.ID, entry.Enc); got != tt.want {
+					t.Errorf("openText() of a conversation entry = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
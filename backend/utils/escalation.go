@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	EscalationExplicit      = "explicit_request"
+	EscalationKeyword       = "keyword"
+	EscalationSentiment     = "negative_sentiment"
+	EscalationLowConfidence = "low_confidence"
+)
+
+var humanRequestPhrases = []string{
+	"talk to a human", "speak to a human", "talk to a person", "speak to a person",
+	"real person", "human agent", "live agent", "live support", "representative",
+	"talk to an agent", "speak to an agent", "speak to someone",
+	"canlı destek", "müşteri temsilcisi", "temsilci ile", "temsilciyle",
+	"gerçek bir kişi", "gerçek kişi", "insanla görüş", "yetkili ile", "yetkiliyle", "operatör",
+}
+
+var lowConfidencePhrases = []string{
+	"i'm not sure", "i am not sure", "i don't know", "i do not know",
+	"i can't help", "i cannot help", "i'm unable to", "i am unable to",
+	"emin değilim", "bilmiyorum", "yardımcı olamıyorum", "bilgim yok", "bilgiye sahip değilim",
+}
+
+// sentimentLexicon weighs words that signal an unhappy customer.
+var sentimentLexicon = map[string]int{
+	"terrible": -3, "awful": -3, "horrible": -3, "worst": -3, "useless": -3,
+	"unacceptable": -3, "scam": -3, "furious": -3, "hate": -3, "garbage": -3,
+	"ridiculous": -2, "angry": -2, "disappointed": -2, "stupid": -2, "annoying": -2,
+	"bad": -1, "wrong": -1, "broken": -1, "never": -1, "still": -1,
+	"berbat": -3, "rezalet": -3, "rezil": -3, "dolandırıcı": -3, "nefret": -3, "felaket": -3,
+	"saçma": -2, "sinir": -2, "bıktım": -2, "yeter": -2, "şikayet": -2, "kızgınım": -2,
+	"kötü": -1, "hala": -1, "hâlâ": -1, "bozuk": -1, "yanlış": -1,
+	"thanks": 2, "thank": 2, "great": 2, "perfect": 2, "teşekkürler": 2, "teşekkür": 2, "harika": 2, "süper": 2,
+}
+
+type escalationConfig struct {
+	keywords           []string
+	sentimentThreshold int
+	lowConfidenceLimit int
+}
+
+var (
+	escalationOnce sync.Once
+	escalation     escalationConfig
+)
+
+func escalationSettings() escalationConfig {
+	escalationOnce.Do(func() {
+		for _, k := range strings.Split(os.Getenv("ESCALATION_KEYWORDS"), ",") {
+			if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+				escalation.keywords = append(escalation.keywords, k)
+			}
+		}
+		escalation.sentimentThreshold = IntEnv("ESCALATION_SENTIMENT_THRESHOLD", -4)
+		escalation.lowConfidenceLimit = IntEnv("ESCALATION_LOW_CONFIDENCE_LIMIT", 2)
+	})
+	return escalation
+}
+
+// DetectEscalation checks a customer message for reasons to hand the
+// session to a human.
+func DetectEscalation(text string) (string, bool) {
+	cfg := escalationSettings()
+	lower := strings.ToLower(text)
+
+	for _, phrase := range humanRequestPhrases {
+		if strings.Contains(lower, phrase) {
+			return EscalationExplicit, true
+		}
+	}
+	for _, keyword := range cfg.keywords {
+		if strings.Contains(lower, keyword) {
+			return EscalationKeyword, true
+		}
+	}
+	if SentimentScore(text) <= cfg.sentimentThreshold {
+		return EscalationSentiment, true
+	}
+	return "", false
+}
+
+// SentimentScore sums the lexicon weights of the words in text. Shouting
+// (several exclamation marks or mostly capital letters) makes a negative
+// score worse.
+func SentimentScore(text string) int {
+	score := 0
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		score += sentimentLexicon[word]
+	}
+	if score < 0 && (strings.Count(text, "!") >= 3 || mostlyUpper(text)) {
+		score--
+	}
+	return score
+}
+
+func mostlyUpper(text string) bool {
+	upper, letters := 0, 0
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	return letters >= 10 && upper*10 >= letters*8
+}
+
+// IsLowConfidence reports whether an AI reply admits it cannot answer.
+func IsLowConfidence(reply string) bool {
+	lower := strings.ToLower(strings.ReplaceAll(reply, "’", "'"))
+	for _, phrase := range lowConfidencePhrases {
+		if strings.Contains(lower, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// LowConfidenceLimit is how many low-confidence replies in a row escalate a
+// session.
+func LowConfidenceLimit() int {
+	return escalationSettings().lowConfidenceLimit
+}
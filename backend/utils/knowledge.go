@@ -0,0 +1,273 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	KBFormatMarkdown = "markdown"
+	KBFormatHTML     = "html"
+	KBFormatText     = "text"
+)
+
+const (
+	defaultKBChunkTokens = 200
+	defaultKBTopK        = 4
+)
+
+func KBArticleColl() *mongo.Collection {
+	return MongoDB.Collection("kb_articles")
+}
+
+func KBChunkColl() *mongo.Collection {
+	return MongoDB.Collection("kb_chunks")
+}
+
+type KBMatch struct {
+	ArticleID primitive.ObjectID `json:"articleId"`
+	Title     string             `json:"title"`
+	Text      string             `json:"text"`
+	Score     float64            `json:"score"`
+}
+
+var (
+	htmlDropBlocks = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(script|style|head)>`)
+	htmlBreaks     = regexp.MustCompile(`(?i)<\s*(br|/p|/div|/li|/h[1-6]|/tr)\s*/?>`)
+	htmlTags       = regexp.MustCompile(`(?s)<[^>]+>`)
+	mdImages       = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLinks        = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	mdMarkers      = regexp.MustCompile("(?m)^\\s{0,3}(#{1,6}\\s+|>\\s?|[-*+]\\s+|```.*$)")
+	mdEmphasis     = regexp.MustCompile("(\\*\\*|__|\\*|`)")
+	blankLines     = regexp.MustCompile(`\n\s*\n+`)
+	spaces         = regexp.MustCompile(`[ \t]+`)
+)
+
+func IsKBFormat(format string) bool {
+	return format == KBFormatMarkdown || format == KBFormatHTML || format == KBFormatText
+}
+
+// PlainText strips an article's markup. PDFs are expected as already
+// extracted text.
+func PlainText(format, source string) (string, error) {
+	text := strings.ReplaceAll(source, "\r\n", "\n")
+	switch format {
+	case KBFormatHTML:
+		text = htmlDropBlocks.ReplaceAllString(text, "")
+		text = htmlBreaks.ReplaceAllString(text, "\n\n")
+		text = htmlTags.ReplaceAllString(text, " ")
+		text = html.UnescapeString(text)
+	case KBFormatMarkdown:
+		text = mdImages.ReplaceAllString(text, "$1")
+		text = mdLinks.ReplaceAllString(text, "$1")
+		text = mdMarkers.ReplaceAllString(text, "")
+		text = mdEmphasis.ReplaceAllString(text, "")
+	case KBFormatText:
+	default:
+		return "", fmt.Errorf("unsupported format %q", format)
+	}
+
+	text = spaces.ReplaceAllString(text, " ")
+	text = blankLines.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text), nil
+}
+
+// ChunkText packs paragraphs into chunks of about maxTokens, splitting
+// paragraphs that are too long on their own at word boundaries.
+func ChunkText(text string, maxTokens int) []string {
+	var chunks []string
+	var current strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(current.String()); s != "" {
+			chunks = append(chunks, s)
+		}
+		current.Reset()
+	}
+
+	for _, para := range strings.Split(text, "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		if EstimateTokens(current.String())+EstimateTokens(para) > maxTokens {
+			flush()
+		}
+		if EstimateTokens(para) <= maxTokens {
+			if current.Len() > 0 {
+				current.WriteString("\n\n")
+			}
+			current.WriteString(para)
+			continue
+		}
+		for _, word := range strings.Fields(para) {
+			if EstimateTokens(current.String())+EstimateTokens(word)+1 > maxTokens {
+				flush()
+			}
+			if current.Len() > 0 {
+				current.WriteString(" ")
+			}
+			current.WriteString(word)
+		}
+	}
+	flush()
+	return chunks
+}
+
+// IndexArticle replaces the article's chunks with freshly embedded ones.
+func IndexArticle(ctx context.Context, article *models.KBArticle) error {
+	text, err := PlainText(article.Format, article.Source)
+	if err != nil {
+		return err
+	}
+	pieces := ChunkText(text, IntEnv("KB_CHUNK_TOKENS", defaultKBChunkTokens))
+	if len(pieces) == 0 {
+		return fmt.Errorf("article has no text")
+	}
+
+	embedInput := make([]string, len(pieces))
+	for i, piece := range pieces {
+		embedInput[i] = article.Title + "\n" + piece
+	}
+	vectors, err := Embeddings.Embed(ctx, embedInput)
+	if err != nil {
+		return fmt.Errorf("failed to embed article: %w", err)
+	}
+
+	docs := make([]interface{}, len(pieces))
+	for i, piece := range pieces {
+		docs[i] = models.KBChunk{
+			ArticleID: article.ID,
+			Index:     i,
+			Text:      piece,
+			Embedder:  Embeddings.Name(),
+			Vector:    vectors[i],
+		}
+	}
+
+	if _, err := KBChunkColl().DeleteMany(ctx, bson.M{"articleId": article.ID}); err != nil {
+		return err
+	}
+	if _, err := KBChunkColl().InsertMany(ctx, docs); err != nil {
+		return err
+	}
+
+	article.ChunkCount = len(pieces)
+	article.Embedder = Embeddings.Name()
+	article.UpdatedAt = time.Now()
+	_, err = KBArticleColl().UpdateOne(ctx, bson.M{"_id": article.ID}, bson.M{"$set": bson.M{
+		"chunkCount": article.ChunkCount,
+		"embedder":   article.Embedder,
+		"updatedAt":  article.UpdatedAt,
+	}})
+	return err
+}
+
+func DeleteArticle(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	res, err := KBArticleColl().DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return false, err
+	}
+	_, err = KBChunkColl().DeleteMany(ctx, bson.M{"articleId": id})
+	return res.DeletedCount > 0, err
+}
+
+// SearchKnowledge returns the k chunks most similar to query. The search is
+// a linear scan, which is fine for a support knowledge base of a few
+// thousand chunks.
+func SearchKnowledge(ctx context.Context, query string, k int) ([]KBMatch, error) {
+	if strings.TrimSpace(query) == "" || k <= 0 {
+		return nil, nil
+	}
+	vectors, err := Embeddings.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	queryVec := vectors[0]
+
+	cursor, err := KBChunkColl().Find(ctx, bson.M{"embedder": Embeddings.Name()})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	minScore := FloatEnv("KB_MIN_SCORE", 0.2)
+	var matches []KBMatch
+	for cursor.Next(ctx) {
+		var chunk models.KBChunk
+		if err := cursor.Decode(&chunk); err != nil {
+			continue
+		}
+		score := CosineSimilarity(queryVec, chunk.Vector)
+		if score < minScore {
+			continue
+		}
+		matches = append(matches, KBMatch{ArticleID: chunk.ArticleID, Text: chunk.Text, Score: score})
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+
+	titles := map[primitive.ObjectID]string{}
+	for i := range matches {
+		id := matches[i].ArticleID
+		if _, ok := titles[id]; !ok {
+			var article models.KBArticle
+			err := KBArticleColl().FindOne(ctx, bson.M{"_id": id}, options.FindOne().SetProjection(bson.M{"title": 1})).Decode(&article)
+			if err == nil {
+				titles[id] = article.Title
+			}
+		}
+		matches[i].Title = titles[id]
+	}
+	return matches, nil
+}
+
+// RetrieveForTurn is SearchKnowledge with the configured top-k, used for
+// every customer turn in system mode.
+func RetrieveForTurn(ctx context.Context, query string) ([]KBMatch, error) {
+	return SearchKnowledge(ctx, query, IntEnv("KB_TOP_K", defaultKBTopK))
+}
+
+// KnowledgePrompt lists the retrieved excerpts for the system instruction.
+func KnowledgePrompt(matches []KBMatch) string {
+	if len(matches) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("Knowledge base excerpts. Base your answer on them, and if they do not cover the question, say so rather than guessing:\n")
+	for i, m := range matches {
+		fmt.Fprintf(&b, "\n[%d] %s\n%s\n", i+1, m.Title, m.Text)
+	}
+	return b.String()
+}
+
+// CitedArticles returns the distinct article IDs behind the matches, best
+// match first.
+func CitedArticles(matches []KBMatch) []string {
+	seen := map[primitive.ObjectID]bool{}
+	var ids []string
+	for _, m := range matches {
+		if !seen[m.ArticleID] {
+			seen[m.ArticleID] = true
+			ids = append(ids, m.ArticleID.Hex())
+		}
+	}
+	return ids
+}
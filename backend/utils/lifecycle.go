@@ -0,0 +1,242 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Modes and statuses as stored on sessions.
+const (
+	ModeSystem = "system"
+	ModeHuman  = "human"
+
+	StatusActive    = "active"
+	StatusWaiting   = "waiting_for_agent"
+	StatusCompleted = "completed"
+	StatusArchiving = "archiving"
+)
+
+// A session's lifecycle state follows from its mode and status:
+//
+//	ai         system + active             the assistant is answering
+//	queued     system + waiting_for_agent  waiting for an agent
+//	agent      human  + active             an agent owns the session
+//	completed  completed                   ended, by either side
+//	archiving  archiving                   being moved to sessions_archive
+//	archived   -                           moved to sessions_archive
+const (
+	StateNew       = ""
+	StateAI        = "ai"
+	StateQueued    = "queued"
+	StateAgent     = "agent"
+	StateCompleted = "completed"
+	StateArchiving = "archiving"
+	StateArchived  = "archived"
+	StateInvalid   = "invalid"
+)
+
+// Who changed a session, when it was not a signed-in account.
+const ActorSystem = "system"
+
+var transitions = map[string][]string{
+	StateNew:    {StateAI, StateQueued, StateAgent},
+	StateAI:     {StateQueued, StateAgent, StateCompleted},
+	StateQueued: {StateAgent, StateCompleted},
+	// agent -> agent is a transfer; agent -> ai hands the session back to
+	// the assistant when its agent is gone.
+	StateAgent:     {StateAgent, StateAI, StateCompleted},
+	StateCompleted: {StateArchiving},
+	StateArchiving: {StateArchived},
+	// Sessions written before the lifecycle existed can still be closed.
+	StateInvalid: {StateCompleted},
+}
+
+var ErrIllegalTransition = errors.New("illegal session transition")
+
+func SessionEventColl() *mongo.Collection {
+	return MongoDB.Collection("session_events")
+}
+
+// SessionState returns the lifecycle state of a stored session, or
+// StateInvalid for mode and status combinations the lifecycle does not know.
+func SessionState(session models.Session) string {
+	switch {
+	case session.Status == StatusCompleted:
+		return StateCompleted
+	case session.Status == StatusArchiving:
+		return StateArchiving
+	case session.Mode == ModeSystem && session.Status == StatusActive:
+		return StateAI
+	case session.Mode == ModeSystem && session.Status == StatusWaiting:
+		return StateQueued
+	case session.Mode == ModeHuman && session.Status == StatusActive:
+		return StateAgent
+	}
+	return StateInvalid
+}
+
+func CanTransition(from, to string) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// stateFields are the mode and status a session is stored with in state.
+// A completed session keeps the mode it ended in.
+func stateFields(state string) bson.M {
+	switch state {
+	case StateAI:
+		return bson.M{"mode": ModeSystem, "status": StatusActive}
+	case StateQueued:
+		return bson.M{"mode": ModeSystem, "status": StatusWaiting}
+	case StateAgent:
+		return bson.M{"mode": ModeHuman, "status": StatusActive}
+	case StateCompleted:
+		return bson.M{"status": StatusCompleted}
+	case StateArchiving:
+		return bson.M{"status": StatusArchiving}
+	}
+	return nil
+}
+
+func stateFilter(state string) bson.M {
+	switch state {
+	case StateCompleted:
+		return bson.M{"status": StatusCompleted}
+	case StateArchiving:
+		return bson.M{"status": StatusArchiving}
+	}
+	return stateFields(state)
+}
+
+// Transition describes a change of state. Set holds any other fields that
+// change along with it, such as assignedAgent.
+type Transition struct {
+	To     string
+	Actor  string
+	Reason string
+	Set    bson.M
+}
+
+// NewSession creates a session in its first state and records how it came
+// to be.
+func NewSession(ctx context.Context, session *models.Session, actor, reason string) error {
+	state := SessionState(*session)
+	if !CanTransition(StateNew, state) {
+		return fmt.Errorf("%w: new session cannot start %s", ErrIllegalTransition, state)
+	}
+	res, err := SessionColl.InsertOne(ctx, session)
+	if err != nil {
+		return err
+	}
+	session.ID = res.InsertedID.(primitive.ObjectID)
+	recordTransition(ctx, *session, StateNew, state, actor, reason)
+	return nil
+}
+
+// TransitionSession moves a session from the state it was seen in to t.To.
+// The update only applies while the session still has the state and owner
+// it was seen with, so it reports false rather than overwrite a change made
+// in the meantime. Transitions the lifecycle does not allow fail with
+// ErrIllegalTransition.
+func TransitionSession(ctx context.Context, seen models.Session, t Transition) (models.Session, bool, error) {
+	filter := stateFilter(SessionState(seen))
+	if filter == nil {
+		filter = bson.M{"mode": seen.Mode, "status": seen.Status}
+	}
+	filter["_id"] = seen.ID
+	filter["assignedAgent"] = seen.AssignedAgent
+	return transition(ctx, filter, SessionState(seen), t)
+}
+
+// TransitionSessionFrom is TransitionSession for callers that have not
+// read the session, e.g. agents claiming it: the first of the from states
+// the session is still in wins.
+func TransitionSessionFrom(ctx context.Context, sessionID primitive.ObjectID, t Transition, from ...string) (models.Session, bool, error) {
+	for _, state := range from {
+		filter := stateFilter(state)
+		if filter == nil {
+			continue
+		}
+		filter["_id"] = sessionID
+		session, ok, err := transition(ctx, filter, state, t)
+		if err != nil || ok {
+			return session, ok, err
+		}
+	}
+	return models.Session{}, false, nil
+}
+
+func transition(ctx context.Context, filter bson.M, from string, t Transition) (models.Session, bool, error) {
+	if !CanTransition(from, t.To) {
+		return models.Session{}, false, fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, from, t.To)
+	}
+
+	set := bson.M{"lastActivity": time.Now()}
+	for k, v := range t.Set {
+		set[k] = v
+	}
+	for k, v := range stateFields(t.To) {
+		set[k] = v
+	}
+
+	var session models.Session
+	err := SessionColl.FindOneAndUpdate(ctx, filter,
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return session, false, nil
+	}
+	if err != nil {
+		return session, false, err
+	}
+	recordTransition(ctx, session, from, t.To, t.Actor, t.Reason)
+	return session, true, nil
+}
+
+// recordTransition appends to the session's history. The history is an
+// audit trail, not the source of truth, so a failed write is only logged.
+func recordTransition(ctx context.Context, session models.Session, from, to, actor, reason string) {
+	event := models.SessionEvent{
+		SessionID: session.ID,
+		From:      from,
+		To:        to,
+		Actor:     actor,
+		Reason:    reason,
+		Agent:     session.AssignedAgent,
+		At:        time.Now(),
+	}
+	if _, err := SessionEventColl().InsertOne(ctx, event); err != nil {
+		log.Printf("[LIFECYCLE][ERROR] Failed to record %s -> %s for session %s: %v", from, to, session.ID.Hex(), err)
+	}
+}
+
+// FindSessionEvents returns a session's transitions, oldest first.
+func FindSessionEvents(ctx context.Context, sessionID primitive.ObjectID) ([]models.SessionEvent, error) {
+	cursor, err := SessionEventColl().Find(ctx,
+		bson.M{"sessionId": sessionID},
+		options.Find().SetSort(bson.D{{Key: "at", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	events := []models.SessionEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"backend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSessionState(t *testing.T) {
+	tests := []struct {
+		mode, status string
+		want         string
+	}{
+		{ModeSystem, StatusActive, StateAI},
+		{ModeSystem, StatusWaiting, StateQueued},
+		{ModeHuman, StatusActive, StateAgent},
+		{ModeHuman, StatusCompleted, StateCompleted},
+		{ModeSystem, StatusCompleted, StateCompleted},
+		{ModeHuman, StatusArchiving, StateArchiving},
+		{ModeHuman, StatusWaiting, StateInvalid},
+		{"", "", StateInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+"/"+tt.status, func(t *testing.T) {
+			if got := SessionState(models.Session{Mode: tt.mode, Status: tt.status}); got != tt.want {
+				t.Errorf("SessionState() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{StateNew, StateAI, true},
+		{StateNew, StateQueued, true},
+		{StateNew, StateAgent, true},
+		{StateNew, StateCompleted, false},
+		{StateAI, StateQueued, true},
+		{StateAI, StateAgent, true},
+		{StateAI, StateCompleted, true},
+		{StateAI, StateAI, false},
+		{StateQueued, StateAgent, true},
+		{StateQueued, StateCompleted, true},
+		{StateQueued, StateAI, false},
+		{StateAgent, StateAgent, true},
+		{StateAgent, StateAI, true},
+		{StateAgent, StateCompleted, true},
+		{StateAgent, StateQueued, false},
+		{StateCompleted, StateArchiving, true},
+		{StateCompleted, StateArchived, false},
+		{StateCompleted, StateAI, false},
+		{StateCompleted, StateAgent, false},
+		{StateArchiving, StateArchived, true},
+		{StateArchiving, StateCompleted, false},
+		{StateArchived, StateCompleted, false},
+		{StateInvalid, StateCompleted, true},
+		{StateInvalid, StateAgent, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			if got := CanTransition(tt.from, tt.to); got != tt.want {
+				t.Errorf("CanTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+// Illegal transitions are refused before the database is touched, so these
+// run without one.
+func TestTransitionSessionRejectsIllegalTransitions(t *testing.T) {
+	id := primitive.NewObjectID()
+	tests := []struct {
+		name string
+		seen models.Session
+		to   string
+	}{
+		{"reopen completed", models.Session{ID: id, Mode: ModeHuman, Status: StatusCompleted}, StateAgent},
+		{"queue agent session", models.Session{ID: id, Mode: ModeHuman, Status: StatusActive}, StateQueued},
+		{"skip archiving", models.Session{ID: id, Mode: ModeSystem, Status: StatusCompleted}, StateArchived},
+		{"hand queued back to the assistant", models.Session{ID: id, Mode: ModeSystem, Status: StatusWaiting}, StateAI},
+		{"invalid to agent", models.Session{ID: id, Mode: "unknown", Status: StatusActive}, StateAgent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok, err := TransitionSession(context.Background(), tt.seen, Transition{To: tt.to, Actor: ActorSystem})
+			if ok || !errors.Is(err, ErrIllegalTransition) {
+				t.Errorf("TransitionSession() = %v, %v, want ErrIllegalTransition", ok, err)
+			}
+		})
+	}
+
+	t.Run("new session", func(t *testing.T) {
+		session := models.Session{Mode: ModeHuman, Status: StatusCompleted}
+		if err := NewSession(context.Background(), &session, ActorSystem, "test"); !errors.Is(err, ErrIllegalTransition) {
+			t.Errorf("NewSession() = %v, want ErrIllegalTransition", err)
+		}
+	})
+}
+
+func TestStateFilter(t *testing.T) {
+	tests := []struct {
+		state      string
+		wantMode   interface{}
+		wantStatus interface{}
+	}{
+		{StateAI, ModeSystem, StatusActive},
+		{StateQueued, ModeSystem, StatusWaiting},
+		{StateAgent, ModeHuman, StatusActive},
+		{StateCompleted, nil, StatusCompleted},
+		{StateArchiving, nil, StatusArchiving},
+	}
+	for _, tt := range tests {
+		t.Run(tt.state, func(t *testing.T) {
+			f := stateFilter(tt.state)
+			if f["mode"] != tt.wantMode || f["status"] != tt.wantStatus {
+				t.Errorf("stateFilter(%q) = %v", tt.state, f)
+			}
+		})
+	}
+	if f := stateFilter(StateArchived); f != nil {
+		t.Errorf("stateFilter(archived) = %v, want nil", f)
+	}
+}
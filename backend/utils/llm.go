@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	LLMRoleUser      = "user"
+	LLMRoleAssistant = "assistant"
+)
+
+const defaultLLMTimeout = 60 * time.Second
+
+type LLMMessage struct {
+	Role string
+	Text string
+}
+
+// LLMRequest is provider-neutral. System carries the instructions that
+// precede the conversation; Messages alternate between user and assistant.
+type LLMRequest struct {
+	System    string
+	Messages  []LLMMessage
+	MaxTokens int
+}
+
+type LLMUsage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+type LLMResponse struct {
+	Text  string
+	Model string
+	Usage LLMUsage
+}
+
+type LLMProvider interface {
+	Model() string
+	Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error)
+	// Stream calls onDelta with each piece of the reply as it is produced and
+	// returns the complete reply once the model is done. A non-nil error from
+	// onDelta aborts the stream.
+	Stream(ctx context.Context, req LLMRequest, onDelta func(string) error) (*LLMResponse, error)
+}
+
+var LLM LLMProvider
+
+// InitLLM selects the provider named by LLM_PROVIDER: gemini (default),
+// openai for any OpenAI-compatible endpoint, or scripted.
+func InitLLM() error {
+	provider, err := newLLMProvider(strings.ToLower(os.Getenv("LLM_PROVIDER")))
+	if err != nil {
+		return err
+	}
+	LLM = provider
+	LLMContextTokens = IntEnv("LLM_CONTEXT_TOKENS", defaultLLMContextTokens)
+	log.Printf("[LLM] Using model %s", provider.Model())
+	return nil
+}
+
+func newLLMProvider(name string) (LLMProvider, error) {
+	client := &http.Client{Timeout: DurationEnv("LLM_TIMEOUT", defaultLLMTimeout)}
+
+	switch name {
+	case "", "gemini":
+		apiKey := os.Getenv("GEMINI_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("GEMINI_API_KEY is not set")
+		}
+		return &GeminiProvider{
+			BaseURL: envOr("GEMINI_BASE_URL", "https://generativelanguage.googleapis.com/v1beta"),
+			APIKey:  apiKey,
+			Name:    envOr("GEMINI_MODEL", "gemini-2.0-flash"),
+			Client:  client,
+		}, nil
+	case "openai":
+		model := os.Getenv("OPENAI_MODEL")
+		if model == "" {
+			return nil, fmt.Errorf("OPENAI_MODEL is not set")
+		}
+		return &OpenAIProvider{
+			BaseURL: strings.TrimRight(envOr("OPENAI_BASE_URL", "https://api.openai.com/v1"), "/"),
+			APIKey:  os.Getenv("OPENAI_API_KEY"),
+			Name:    model,
+			Client:  client,
+		}, nil
+	case "scripted":
+		var replies []string
+		if path := os.Getenv("LLM_SCRIPT"); path != "" {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open LLM_SCRIPT: %w", err)
+			}
+			defer f.Close()
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				if line := strings.TrimSpace(scanner.Text()); line != "" {
+					replies = append(replies, line)
+				}
+			}
+		}
+		return NewScriptedProvider(replies...), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM_PROVIDER %q", name)
+	}
+}
+
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"unicode/utf8"
+
+	"backend/models"
+)
+
+const defaultLLMContextTokens = 4000
+
+// LLMContextTokens caps the estimated size of the conversation history sent
+// with each request.
+var LLMContextTokens = defaultLLMContextTokens
+
+// EstimateTokens approximates a token count without a tokenizer, at roughly
+// four characters per token.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// ConversationForLLM turns a session's stored messages into model turns.
+// Agent replies from human-mode stretches count as assistant turns so the
+// model knows what the customer has already been told. The oldest turns are
+// dropped until the rest fits in budget, but the latest one is always kept.
+func ConversationForLLM(messages []models.Message, budget int) []LLMMessage {
+	var turns []LLMMessage
+	for _, msg := range messages {
+		role := LLMRoleAssistant
+		if msg.Sender == "user" {
+			role = LLMRoleUser
+		}
+		// Providers expect the roles to alternate.
+		if n := len(turns); n > 0 && turns[n-1].Role == role {
+			turns[n-1].Text += "\n\n" + msg.Text
+			continue
+		}
+		turns = append(turns, LLMMessage{Role: role, Text: msg.Text})
+	}
+
+	start := len(turns)
+	used := 0
+	for start > 0 {
+		cost := EstimateTokens(turns[start-1].Text)
+		if used+cost > budget && start < len(turns) {
+			break
+		}
+		used += cost
+		start--
+	}
+
+	// The conversation has to open with the customer.
+	for start < len(turns)-1 && turns[start].Role != LLMRoleUser {
+		start++
+	}
+	return turns[start:]
+}
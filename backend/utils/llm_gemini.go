@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type GeminiProvider struct {
+	BaseURL string
+	APIKey  string
+	Name    string
+	Client  *http.Client
+}
+
+type geminiPart struct {
+	Text string `json:"text"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiRequest struct {
+	SystemInstruction *geminiContent  `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent `json:"contents"`
+	GenerationConfig  struct {
+		MaxOutputTokens int `json:"maxOutputTokens,omitempty"`
+	} `json:"generationConfig"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content geminiContent `json:"content"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+func (g *GeminiProvider) Model() string {
+	return g.Name
+}
+
+func (g *GeminiProvider) Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	resp, err := g.post(ctx, "generateContent", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out geminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	text := out.text()
+	if text == "" {
+		return nil, errors.New("gemini returned no response")
+	}
+
+	return &LLMResponse{Text: text, Model: g.Name, Usage: out.usage()}, nil
+}
+
+func (g *GeminiProvider) Stream(ctx context.Context, req LLMRequest, onDelta func(string) error) (*LLMResponse, error) {
+	resp, err := g.post(ctx, "streamGenerateContent?alt=sse", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	var usage LLMUsage
+	err = readSSE(resp.Body, func(data string) error {
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return err
+		}
+		if chunk.UsageMetadata.TotalTokenCount > 0 {
+			usage = chunk.usage()
+		}
+		delta := chunk.text()
+		if delta == "" {
+			return nil
+		}
+		text.WriteString(delta)
+		return onDelta(delta)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if text.Len() == 0 {
+		return nil, errors.New("gemini returned no response")
+	}
+
+	return &LLMResponse{Text: text.String(), Model: g.Name, Usage: usage}, nil
+}
+
+func (g *GeminiProvider) post(ctx context.Context, method string, req LLMRequest) (*http.Response, error) {
+	body := geminiRequest{}
+	if req.System != "" {
+		body.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: req.System}}}
+	}
+	for _, m := range req.Messages {
+		role := "user"
+		if m.Role == LLMRoleAssistant {
+			role = "model"
+		}
+		body.Contents = append(body.Contents, geminiContent{Role: role, Parts: []geminiPart{{Text: m.Text}}})
+	}
+	body.GenerationConfig.MaxOutputTokens = req.MaxTokens
+
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/models/%s:%s", strings.TrimRight(g.BaseURL, "/"), g.Name, method)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-goog-api-key", g.APIKey)
+
+	resp, err := g.Client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("gemini API error (%d): %s", resp.StatusCode, string(bodyBytes))
+	}
+	return resp, nil
+}
+
+func (r geminiResponse) text() string {
+	if len(r.Candidates) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for _, p := range r.Candidates[0].Content.Parts {
+		b.WriteString(p.Text)
+	}
+	return b.String()
+}
+
+func (r geminiResponse) usage() LLMUsage {
+	return LLMUsage{
+		PromptTokens:     r.UsageMetadata.PromptTokenCount,
+		CompletionTokens: r.UsageMetadata.CandidatesTokenCount,
+		TotalTokens:      r.UsageMetadata.TotalTokenCount,
+	}
+}
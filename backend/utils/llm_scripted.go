@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// ScriptedProvider is a deterministic stand-in for a real model. It answers
+// with its replies in order, starting over when they run out, and echoes the
+// last user message when it has none. Token usage is counted in words.
+type ScriptedProvider struct {
+	mu      sync.Mutex
+	replies []string
+	next    int
+}
+
+func NewScriptedProvider(replies ...string) *ScriptedProvider {
+	return &ScriptedProvider{replies: replies}
+}
+
+func (s *ScriptedProvider) Model() string {
+	return "scripted"
+}
+
+func (s *ScriptedProvider) Complete(ctx context.Context, req LLMRequest) (*LLMResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	text := s.reply(req)
+	prompt := len(strings.Fields(req.System))
+	for _, m := range req.Messages {
+		prompt += len(strings.Fields(m.Text))
+	}
+	completion := len(strings.Fields(text))
+
+	return &LLMResponse{
+		Text:  text,
+		Model: s.Model(),
+		Usage: LLMUsage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion},
+	}, nil
+}
+
+// Stream delivers the reply one word at a time.
+func (s *ScriptedProvider) Stream(ctx context.Context, req LLMRequest, onDelta func(string) error) (*LLMResponse, error) {
+	resp, err := s.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	for i, word := range strings.Fields(resp.Text) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			word = " " + word
+		}
+		if err := onDelta(word); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (s *ScriptedProvider) reply(req LLMRequest) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.replies) > 0 {
+		text := s.replies[s.next%len(s.replies)]
+		s.next++
+		return text
+	}
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == LLMRoleUser {
+			return "You said: " + req.Messages[i].Text
+		}
+	}
+	return "Hello! How can I help you?"
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+const maxSSELine = 1 << 20
+
+// readSSE hands the data of each server-sent event to onData until the
+// stream ends or sends the OpenAI-style [DONE] marker.
+func readSSE(r io.Reader, onData func(string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSELine)
+
+	var data strings.Builder
+	flush := func() error {
+		if data.Len() == 0 {
+			return nil
+		}
+		payload := data.String()
+		data.Reset()
+		if payload == "[DONE]" {
+			return io.EOF
+		}
+		return onData(payload)
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if err := flush(); err != nil {
+				return ignoreEOF(err)
+			}
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			if data.Len() > 0 {
+				data.WriteString("\n")
+			}
+			data.WriteString(strings.TrimPrefix(value, " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return ignoreEOF(flush())
+}
+
+func ignoreEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PIIVaultColl keeps the original text of messages whose stored text was
+// redacted, keyed by message ID. Only OriginalMessage reads it.
+func PIIVaultColl() *mongo.Collection {
+	return MongoDB.Collection("pii_vault")
+}
+
+// ErrSessionArchived is returned for writes to a session that is being or
+// has been archived.
+var ErrSessionArchived = errors.New("session is archived")
+
+// NextMessageSeq atomically reserves the next per-session sequence number.
+// Sessions being archived take no more messages.
+func NextMessageSeq(ctx context.Context, sessionID primitive.ObjectID) (int64, error) {
+	var updated struct {
+		LastSeq int64 `bson:"lastSeq"`
+	}
+	err := SessionColl.FindOneAndUpdate(ctx,
+		bson.M{"_id": sessionID, "status": bson.M{"$ne": StatusArchiving}},
+		bson.M{"$inc": bson.M{"lastSeq": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"lastSeq": 1}),
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return 0, ErrSessionArchived
+	}
+	if err != nil {
+		return 0, err
+	}
+	return updated.LastSeq, nil
+}
+
+// InsertSessionMessage stores msg, encrypted if MESSAGE_KEKS is set, and
+// notes the kinds of personal data in it. With PII_REDACT_STORED the stored
+// text is masked and the original goes to the vault. Either way msg.Text is
+// masked on return, ready to be shown, whether or not storing it worked.
+func InsertSessionMessage(ctx context.Context, msg *models.Message) error {
+	// Mask first, so msg never leaves here unmasked, even on failure.
+	masked, kinds := RedactPII(msg.Text)
+	original := msg.Text
+	msg.Text, msg.PII = masked, kinds
+
+	seq, err := NextMessageSeq(ctx, msg.SessionID)
+	if err != nil {
+		return err
+	}
+	msg.Seq = seq
+	if msg.ID.IsZero() {
+		msg.ID = primitive.NewObjectID()
+	}
+
+	stored := *msg
+	stored.Text = original
+	if len(kinds) > 0 && piiSettings().redactStored {
+		vaulted, err := textFields(stored.ID, stored.Text)
+		if err != nil {
+			return err
+		}
+		vaulted["_id"], vaulted["sessionId"], vaulted["at"] = stored.ID, stored.SessionID, time.Now()
+		if _, err := PIIVaultColl().InsertOne(ctx, vaulted); err != nil {
+			return err
+		}
+		stored.Text = masked
+	}
+
+	if err := sealMessage(&stored); err != nil {
+		return err
+	}
+	_, err = MessageColl.InsertOne(ctx, stored)
+	return err
+}
+
+// FindSessionMessages returns a session's messages with a sequence number
+// greater than afterSeq, oldest first, decrypted and with personal data
+// masked. Messages
+// stored before sequence numbers existed have seq 0 and are ordered by
+// timestamp.
+func FindSessionMessages(ctx context.Context, sessionID primitive.ObjectID, afterSeq int64) ([]models.Message, error) {
+	filter := bson.M{"sessionId": sessionID}
+	if afterSeq > 0 {
+		filter["seq"] = bson.M{"$gt": afterSeq}
+	}
+
+	cursor, err := MessageColl.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "seq", Value: 1}, {Key: "timestamp", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var messages []models.Message
+	for cursor.Next(ctx) {
+		var msg models.Message
+		if err := cursor.Decode(&msg); err == nil {
+			openMessage(&msg)
+			// Messages stored before redaction existed are masked too.
+			msg.Text, _ = RedactPII(msg.Text)
+			messages = append(messages, msg)
+		}
+	}
+	return messages, cursor.Err()
+}
+
+// OriginalMessage returns a message, live or archived, exactly as it was
+// written. It is for privileged roles only.
+func OriginalMessage(ctx context.Context, messageID primitive.ObjectID) (models.Message, error) {
+	var msg models.Message
+	err := MessageColl.FindOne(ctx, bson.M{"_id": messageID}).Decode(&msg)
+	if err == mongo.ErrNoDocuments {
+		err = MessageArchiveColl().FindOne(ctx, bson.M{"_id": messageID}).Decode(&msg)
+	}
+	if err != nil {
+		return msg, err
+	}
+	openMessage(&msg)
+	originals, err := originalTexts(ctx, bson.M{"_id": messageID})
+	if err != nil {
+		return msg, err
+	}
+	if text, ok := originals[messageID]; ok {
+		msg.Text = text
+	}
+	return msg, nil
+}
+
+// originalTexts reads the vaulted originals matching filter by message ID.
+func originalTexts(ctx context.Context, filter bson.M) (map[primitive.ObjectID]string, error) {
+	cursor, err := PIIVaultColl().Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var entries []models.Message
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	originals := make(map[primitive.ObjectID]string, len(entries))
+	for _, e := range entries {
+		openMessage(&e)
+		originals[e.ID] = e.Text
+	}
+	return originals, nil
+}
+
+// LastSessionMessage returns a session's latest message, decrypted and with
+// personal data masked.
+func LastSessionMessage(ctx context.Context, sessionID primitive.ObjectID) (models.Message, error) {
+	var msg models.Message
+	err := MessageColl.FindOne(ctx, bson.M{"sessionId": sessionID},
+		options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}})).Decode(&msg)
+	if err != nil {
+		return msg, err
+	}
+	openMessage(&msg)
+	msg.Text, _ = RedactPII(msg.Text)
+	return msg, nil
+}
@@ -0,0 +1,298 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Data-subject requests cover everything stored under a customer's email:
+// the account in users, their sessions live and archived with all messages
+// and transitions, and conversations saved by /api/chat and /api/agent/send,
+// which keep their messages inline. /api/chat records written before they
+// carried a userId cannot be attributed to anyone and are not covered.
+
+const (
+	ComplianceExport    = "export"
+	ComplianceErasure   = "erasure"
+	CompliancePIIAccess = "pii_access"
+
+	OutcomeCompleted = "completed"
+	OutcomeRefused   = "refused"
+	OutcomeFailed    = "failed"
+
+	ErasedText = "[erased]"
+)
+
+var ErrLegalHold = errors.New("data is under legal hold")
+
+func ComplianceLogColl() *mongo.Collection {
+	return MongoDB.Collection("compliance_log")
+}
+
+// SubjectHash identifies a data subject in the compliance log without
+// keeping their email there.
+func SubjectHash(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
+
+func LogComplianceRequest(ctx context.Context, record models.ComplianceRecord) error {
+	record.At = time.Now()
+	_, err := ComplianceLogColl().InsertOne(ctx, record)
+	return err
+}
+
+type ExportMessage struct {
+	ID        primitive.ObjectID `json:"id"`
+	Seq       int64              `json:"seq"`
+	Sender    string             `json:"sender"`
+	Text      string             `json:"text"`
+	Timestamp time.Time          `json:"timestamp"`
+	Citations []string           `json:"citations,omitempty"`
+}
+
+type ExportSession struct {
+	models.Session
+	Archived bool                  `json:"archived"`
+	Messages []ExportMessage       `json:"messages"`
+	Events   []models.SessionEvent `json:"events"`
+}
+
+type DataExport struct {
+	Subject       string          `json:"subject"`
+	ExportedAt    time.Time       `json:"exportedAt"`
+	Account       bson.M          `json:"account"`
+	Sessions      []ExportSession `json:"sessions"`
+	Conversations []bson.M        `json:"conversations"`
+}
+
+// CollectUserData gathers everything held about a customer. It fails with
+// mongo.ErrNoDocuments if there is no such account.
+func CollectUserData(ctx context.Context, email string) (DataExport, error) {
+	export := DataExport{Subject: email, ExportedAt: time.Now(), Sessions: []ExportSession{}, Conversations: []bson.M{}}
+
+	if err := UserColl().FindOne(ctx, bson.M{"email": email}).Decode(&export.Account); err != nil {
+		return export, err
+	}
+	delete(export.Account, "password")
+
+	for _, src := range []struct {
+		sessions, messages *mongo.Collection
+		archived           bool
+	}{
+		{SessionColl, MessageColl, false},
+		{SessionArchiveColl(), MessageArchiveColl(), true},
+	} {
+		cursor, err := src.sessions.Find(ctx, bson.M{"userId": email}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+		if err != nil {
+			return export, err
+		}
+		var sessions []models.Session
+		if err := cursor.All(ctx, &sessions); err != nil {
+			return export, err
+		}
+		for _, s := range sessions {
+			messages, err := exportMessages(ctx, src.messages, s.ID)
+			if err != nil {
+				return export, err
+			}
+			events, err := FindSessionEvents(ctx, s.ID)
+			if err != nil {
+				return export, err
+			}
+			export.Sessions = append(export.Sessions, ExportSession{Session: s, Archived: src.archived, Messages: messages, Events: events})
+		}
+	}
+
+	conversations, err := exportConversations(ctx, email)
+	if err != nil {
+		return export, err
+	}
+	export.Conversations = conversations
+	return export, nil
+}
+
+func exportMessages(ctx context.Context, coll *mongo.Collection, sessionID primitive.ObjectID) ([]ExportMessage, error) {
+	cursor, err := coll.Find(ctx, bson.M{"sessionId": sessionID},
+		options.Find().SetSort(bson.D{{Key: "seq", Value: 1}, {Key: "timestamp", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var messages []models.Message
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	// Customers get back what they actually wrote, not the masked copy.
+	originals, err := originalTexts(ctx, bson.M{"sessionId": sessionID})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ExportMessage, 0, len(messages))
+	for _, m := range messages {
+		openMessage(&m)
+		if text, ok := originals[m.ID]; ok {
+			m.Text = text
+		}
+		out = append(out, ExportMessage{ID: m.ID, Seq: m.Seq, Sender: m.Sender, Text: m.Text, Timestamp: m.Timestamp, Citations: m.Citations})
+	}
+	return out, nil
+}
+
+type ErasureResult struct {
+	Pseudonym     string
+	Sessions      int64
+	Messages      int64
+	Conversations int64
+	// Closed are the sessions that were still open, for the caller to tell
+	// whoever is connected.
+	Closed []models.Session
+}
+
+// EraseUser irreversibly anonymizes a customer. The account and sessions
+// keep their shape, timestamps, modes and agents so statistics still add up,
+// but every email is replaced by a random pseudonym and every message text
+// in their sessions and conversations is blanked, vaulted originals deleted.
+// Customers or sessions under legal hold are refused with ErrLegalHold.
+func EraseUser(ctx context.Context, email string) (ErasureResult, error) {
+	var result ErasureResult
+
+	var account struct {
+		LegalHold bool `bson:"legalHold"`
+	}
+	if err := UserColl().FindOne(ctx, bson.M{"email": email}).Decode(&account); err != nil {
+		return result, err
+	}
+	held := account.LegalHold
+	for _, coll := range []*mongo.Collection{SessionColl, SessionArchiveColl()} {
+		n, err := coll.CountDocuments(ctx, bson.M{"userId": email, "legalHold": true})
+		if err != nil {
+			return result, err
+		}
+		held = held || n > 0
+	}
+	if held {
+		return result, ErrLegalHold
+	}
+
+	pseudonym, err := newPseudonym()
+	if err != nil {
+		return result, err
+	}
+	result.Pseudonym = pseudonym
+
+	cursor, err := SessionColl.Find(ctx, bson.M{"userId": email, "status": bson.M{"$nin": bson.A{StatusCompleted, StatusArchiving}}})
+	if err != nil {
+		return result, err
+	}
+	var open []models.Session
+	if err := cursor.All(ctx, &open); err != nil {
+		return result, err
+	}
+	for _, s := range open {
+		if ok, err := CloseSession(ctx, s, ActorSystem, CloseErased); err == nil && ok {
+			result.Closed = append(result.Closed, s)
+		}
+	}
+
+	blank := bson.M{"$set": bson.M{"text": ErasedText, "erased": true}, "$unset": bson.M{"enc": ""}}
+	for _, src := range []struct{ sessions, messages *mongo.Collection }{
+		{SessionColl, MessageColl},
+		{SessionArchiveColl(), MessageArchiveColl()},
+	} {
+		ids, err := src.sessions.Distinct(ctx, "_id", bson.M{"userId": email})
+		if err != nil {
+			return result, err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		res, err := src.messages.UpdateMany(ctx, bson.M{"sessionId": bson.M{"$in": ids}}, blank)
+		if err != nil {
+			return result, err
+		}
+		result.Messages += res.ModifiedCount
+		if _, err := PIIVaultColl().DeleteMany(ctx, bson.M{"sessionId": bson.M{"$in": ids}}); err != nil {
+			return result, err
+		}
+
+		sres, err := src.sessions.UpdateMany(ctx, bson.M{"userId": email}, bson.M{"$set": bson.M{"userId": pseudonym}})
+		if err != nil {
+			return result, err
+		}
+		result.Sessions += sres.ModifiedCount
+	}
+
+	conversations, err := MessageColl.Distinct(ctx, "_id", conversationFilter(bson.M{"userId": email}))
+	if err != nil {
+		return result, err
+	}
+	if len(conversations) > 0 {
+		if _, err := PIIVaultColl().DeleteMany(ctx, bson.M{"conversationId": bson.M{"$in": conversations}}); err != nil {
+			return result, err
+		}
+	}
+	for _, field := range conversationFields {
+		if _, err := MessageColl.UpdateMany(ctx,
+			bson.M{"userId": email, field: bson.M{"$type": "array"}},
+			bson.M{"$set": bson.M{field + ".$[].text": ErasedText}, "$unset": bson.M{field + ".$[].enc": ""}},
+		); err != nil {
+			return result, err
+		}
+	}
+	res, err := MessageColl.UpdateMany(ctx, bson.M{"userId": email}, bson.M{"$set": bson.M{"userId": pseudonym, "erased": true}})
+	if err != nil {
+		return result, err
+	}
+	result.Conversations = res.ModifiedCount
+
+	if _, err := SessionEventColl().UpdateMany(ctx, bson.M{"actor": email}, bson.M{"$set": bson.M{"actor": pseudonym}}); err != nil {
+		return result, err
+	}
+
+	_, err = UserColl().UpdateOne(ctx, bson.M{"email": email}, bson.M{"$set": bson.M{
+		"email":    pseudonym,
+		"name":     "",
+		"password": "",
+		"erasedAt": time.Now(),
+	}})
+	return result, err
+}
+
+// AccountErased reports whether the customer behind p has been erased. Their
+// account keeps its _id, so access tokens issued before the erasure would
+// otherwise stay valid until they expire.
+func AccountErased(ctx context.Context, p *Principal) bool {
+	if IsStaffRole(p.Role) {
+		return false
+	}
+	objID, err := primitive.ObjectIDFromHex(p.ID)
+	if err != nil {
+		return false
+	}
+	n, err := UserColl().CountDocuments(ctx, bson.M{"_id": objID, "erasedAt": bson.M{"$exists": true}})
+	return err == nil && n > 0
+}
+
+// newPseudonym is random rather than derived from the email, so an erased
+// customer cannot be re-identified by hashing a guess. It is shaped like an
+// email, as it replaces one on the account and on sessions and messages
+// alike, but can never receive mail.
+func newPseudonym() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "erased-" + hex.EncodeToString(b) + "@erased.invalid", nil
+}
@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+	"time"
+
+	"backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultTenant  = "default"
+	DefaultChannel = "web"
+)
+
+// DefaultPromptTemplate applies when no template is stored for a tenant.
+var DefaultPromptTemplate = models.PromptTemplate{
+	Tenant:   DefaultTenant,
+	Persona:  "a friendly customer support assistant",
+	Tone:     "polite, concise and helpful",
+	Language: "the customer's language",
+	Instructions: "If you are not sure about an answer, say so and offer to connect the customer " +
+		"with a human agent instead of guessing.",
+}
+
+// PromptVars are available to a template's Instructions as {{.CustomerName}},
+// {{.History}} and so on.
+type PromptVars struct {
+	Tenant        string
+	Channel       string
+	Company       string
+	CustomerName  string
+	CustomerEmail string
+	Date          string
+	History       string
+}
+
+func PromptColl() *mongo.Collection {
+	return MongoDB.Collection("prompt_templates")
+}
+
+// FindPromptTemplate returns the most specific template for tenant and
+// channel: an exact match, then the tenant's channel-less template, then the
+// default tenant's, then DefaultPromptTemplate.
+func FindPromptTemplate(ctx context.Context, tenant, channel string) (models.PromptTemplate, error) {
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+	candidates := []bson.M{
+		{"tenant": tenant, "channel": channel},
+		{"tenant": tenant, "channel": ""},
+		{"tenant": DefaultTenant, "channel": ""},
+	}
+	for _, filter := range candidates {
+		var tpl models.PromptTemplate
+		err := PromptColl().FindOne(ctx, filter).Decode(&tpl)
+		if err == nil {
+			return tpl, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			return DefaultPromptTemplate, err
+		}
+	}
+	return DefaultPromptTemplate, nil
+}
+
+// SavePromptTemplate creates or replaces the template for its tenant and
+// channel.
+func SavePromptTemplate(ctx context.Context, tpl *models.PromptTemplate) error {
+	if _, err := template.New("instructions").Parse(tpl.Instructions); err != nil {
+		return fmt.Errorf("invalid instructions template: %w", err)
+	}
+	tpl.UpdatedAt = time.Now()
+
+	return PromptColl().FindOneAndUpdate(ctx,
+		bson.M{"tenant": tpl.Tenant, "channel": tpl.Channel},
+		bson.M{"$set": bson.M{
+			"company":         tpl.Company,
+			"persona":         tpl.Persona,
+			"tone":            tpl.Tone,
+			"language":        tpl.Language,
+			"forbiddenTopics": tpl.ForbiddenTopics,
+			"facts":           tpl.Facts,
+			"instructions":    tpl.Instructions,
+			"updatedAt":       tpl.UpdatedAt,
+			"updatedBy":       tpl.UpdatedBy,
+		}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(tpl)
+}
+
+func RenderPrompt(tpl models.PromptTemplate, vars PromptVars) (string, error) {
+	if vars.Company == "" {
+		vars.Company = tpl.Company
+	}
+
+	persona := tpl.Persona
+	if persona == "" {
+		persona = DefaultPromptTemplate.Persona
+	}
+
+	var b strings.Builder
+	if tpl.Company != "" {
+		fmt.Fprintf(&b, "You are %s for %s.\n", persona, tpl.Company)
+	} else {
+		fmt.Fprintf(&b, "You are %s.\n", persona)
+	}
+	if tpl.Tone != "" {
+		fmt.Fprintf(&b, "Your tone is %s.\n", tpl.Tone)
+	}
+	if tpl.Language != "" {
+		fmt.Fprintf(&b, "Always answer in %s.\n", tpl.Language)
+	}
+	if vars.CustomerName != "" {
+		fmt.Fprintf(&b, "You are talking to %s.\n", vars.CustomerName)
+	}
+	if len(tpl.ForbiddenTopics) > 0 {
+		b.WriteString("\nNever discuss the following topics; politely decline and steer back to how you can help:\n")
+		for _, topic := range tpl.ForbiddenTopics {
+			fmt.Fprintf(&b, "- %s\n", topic)
+		}
+	}
+	if len(tpl.Facts) > 0 {
+		b.WriteString("\nFacts about the company. Rely on these and do not promise anything they do not cover:\n")
+		for _, fact := range tpl.Facts {
+			fmt.Fprintf(&b, "- %s\n", fact)
+		}
+	}
+
+	if tpl.Instructions != "" {
+		t, err := template.New("instructions").Parse(tpl.Instructions)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString("\n")
+		if err := t.Execute(&b, vars); err != nil {
+			return "", err
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// SystemPrompt renders the system instruction for a conversation with the
+// customer identified by email. Errors are logged and fall back to the
+// default template so the assistant keeps answering.
+func SystemPrompt(ctx context.Context, tenant, channel, email string, history []models.Message) string {
+	tpl, err := FindPromptTemplate(ctx, tenant, channel)
+	if err != nil {
+		log.Printf("[PROMPT][ERROR] Failed to load template for %s/%s: %v", tenant, channel, err)
+	}
+
+	vars := PromptVars{
+		Tenant:        tpl.Tenant,
+		Channel:       channel,
+		CustomerEmail: email,
+		Date:          time.Now().Format("2006-01-02"),
+		History:       transcript(history),
+	}
+	var user struct {
+		Name string `bson:"name"`
+	}
+	if email != "" {
+		if err := MongoDB.Collection("users").FindOne(ctx, bson.M{"email": email}).Decode(&user); err == nil {
+			vars.CustomerName = user.Name
+		}
+	}
+
+	prompt, err := RenderPrompt(tpl, vars)
+	if err != nil {
+		log.Printf("[PROMPT][ERROR] Failed to render template for %s/%s: %v", tenant, channel, err)
+		prompt, _ = RenderPrompt(DefaultPromptTemplate, vars)
+	}
+	return prompt
+}
+
+func transcript(history []models.Message) string {
+	var b strings.Builder
+	for _, msg := range history {
+		switch msg.Sender {
+		case "user":
+			b.WriteString("Customer: ")
+		case "agent":
+			b.WriteString("Agent: ")
+		default:
+			b.WriteString("Assistant: ")
+		}
+		b.WriteString(msg.Text)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
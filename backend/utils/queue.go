@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	RouteFIFO        = "fifo"
+	RouteRoundRobin  = "round_robin"
+	RouteLeastBusy   = "least_busy"
+	RouteLongestIdle = "longest_idle"
+)
+
+// Router decides which available agent gets the next queued session. Rank
+// returns the agents in order of preference; the dispatcher tries them in
+// turn, so an agent claimed elsewhere in the meantime is simply skipped.
+type Router interface {
+	Name() string
+	Rank(ctx context.Context, agents []models.Agent) []models.Agent
+	Assigned(agentID string)
+}
+
+func NewRouter(name string) (Router, error) {
+	switch strings.ToLower(name) {
+	case "", RouteFIFO:
+		return fifoRouter{}, nil
+	case RouteRoundRobin:
+		return &roundRobinRouter{}, nil
+	case RouteLeastBusy:
+		return leastBusyRouter{}, nil
+	case RouteLongestIdle:
+		return longestIdleRouter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown QUEUE_STRATEGY %q", name)
+	}
+}
+
+// fifoRouter hands work to agents in the order they registered.
+type fifoRouter struct{}
+
+func (fifoRouter) Name() string { return RouteFIFO }
+
+func (fifoRouter) Rank(_ context.Context, agents []models.Agent) []models.Agent {
+	return sortedByID(agents)
+}
+
+func (fifoRouter) Assigned(string) {}
+
+// roundRobinRouter walks the agents in registration order, starting after
+// the one that was assigned last. The position is kept per process.
+type roundRobinRouter struct {
+	mu   sync.Mutex
+	last string
+}
+
+func (*roundRobinRouter) Name() string { return RouteRoundRobin }
+
+func (r *roundRobinRouter) Rank(_ context.Context, agents []models.Agent) []models.Agent {
+	ranked := sortedByID(agents)
+
+	r.mu.Lock()
+	last := r.last
+	r.mu.Unlock()
+
+	start := sort.Search(len(ranked), func(i int) bool { return ranked[i].ID.Hex() > last })
+	return append(append([]models.Agent(nil), ranked[start:]...), ranked[:start]...)
+}
+
+func (r *roundRobinRouter) Assigned(agentID string) {
+	r.mu.Lock()
+	r.last = agentID
+	r.mu.Unlock()
+}
+
+// leastBusyRouter prefers the agent with the fewest active chats, and among
+// equals the one assigned longest ago.
+type leastBusyRouter struct{}
+
+func (leastBusyRouter) Name() string { return RouteLeastBusy }
+
+func (leastBusyRouter) Rank(_ context.Context, agents []models.Agent) []models.Agent {
+	ranked := sortedByLastAssigned(agents)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].ActiveSessions < ranked[j].ActiveSessions
+	})
+	return ranked
+}
+
+func (leastBusyRouter) Assigned(string) {}
+
+// longestIdleRouter prefers the agent whose last assignment is oldest.
+type longestIdleRouter struct{}
+
+func (longestIdleRouter) Name() string { return RouteLongestIdle }
+
+func (longestIdleRouter) Rank(_ context.Context, agents []models.Agent) []models.Agent {
+	return sortedByLastAssigned(agents)
+}
+
+func (longestIdleRouter) Assigned(string) {}
+
+func sortedByID(agents []models.Agent) []models.Agent {
+	ranked := append([]models.Agent(nil), agents...)
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].ID.Hex() < ranked[j].ID.Hex() })
+	return ranked
+}
+
+func sortedByLastAssigned(agents []models.Agent) []models.Agent {
+	ranked := sortedByID(agents)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].LastAssignedAt.Before(ranked[j].LastAssignedAt)
+	})
+	return ranked
+}
+
+// QueuedSessions returns the sessions waiting for an agent, longest waiting
+// first.
+func QueuedSessions(ctx context.Context) ([]models.Session, error) {
+	cursor, err := SessionColl.Find(ctx,
+		stateFilter(StateQueued),
+		options.Find().SetSort(bson.D{{Key: "queuedAt", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var sessions []models.Session
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func AvailableAgents(ctx context.Context) ([]models.Agent, error) {
+	cursor, err := AgentColl.Find(ctx, bson.M{"status": "available"})
+	if err != nil {
+		return nil, err
+	}
+	var agents []models.Agent
+	if err := cursor.All(ctx, &agents); err != nil {
+		return nil, err
+	}
+	return agents, nil
+}
+
+// OnlineAgentCount counts agents who are working, free or not.
+func OnlineAgentCount(ctx context.Context) int {
+	n, err := AgentColl.CountDocuments(ctx, bson.M{"status": bson.M{"$in": []string{"available", "busy"}}})
+	if err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+// ClaimSession hands a session in one of the from states to agentID. It
+// reports false if the session was no longer in such a state, which is how
+// two agents racing for the same session are told apart.
+func ClaimSession(ctx context.Context, sessionID primitive.ObjectID, agentID, actor, reason string, from ...string) (models.Session, bool, error) {
+	return TransitionSessionFrom(ctx, sessionID, Transition{
+		To:     StateAgent,
+		Actor:  actor,
+		Reason: reason,
+		Set:    bson.M{"assignedAgent": agentID},
+	}, from...)
+}
+
+// MoveSession hands a session to agentID only if it still has the state and
+// owner the caller last saw, so a transfer or reassignment never overwrites
+// an assignment made in the meantime.
+func MoveSession(ctx context.Context, seen models.Session, agentID, actor, reason string) (models.Session, bool, error) {
+	return TransitionSession(ctx, seen, Transition{
+		To:     StateAgent,
+		Actor:  actor,
+		Reason: reason,
+		Set:    bson.M{"assignedAgent": agentID},
+	})
+}
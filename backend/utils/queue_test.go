@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"backend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testAgent(t *testing.T, name string, active int, lastAssigned time.Duration) models.Agent {
+	t.Helper()
+	// IDs sort like the names, so registration order is a, b, c.
+	hex := map[string]string{
+		"a": "000000000000000000000001",
+		"b": "000000000000000000000002",
+		"c": "000000000000000000000003",
+	}[name]
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var at time.Time
+	if lastAssigned != 0 {
+		at = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC).Add(-lastAssigned)
+	}
+	return models.Agent{ID: id, Name: name, ActiveSessions: active, LastAssignedAt: at}
+}
+
+func names(agents []models.Agent) []string {
+	out := []string{}
+	for _, a := range agents {
+		out = append(out, a.Name)
+	}
+	return out
+}
+
+func TestRouters(t *testing.T) {
+	a := testAgent(t, "a", 2, time.Minute)
+	b := testAgent(t, "b", 0, time.Hour)
+	c := testAgent(t, "c", 0, 0)
+	agents := []models.Agent{c, a, b}
+
+	tests := []struct {
+		strategy string
+		assigned []string
+		want     []string
+	}{
+		{RouteFIFO, nil, []string{"a", "b", "c"}},
+		{RouteFIFO, []string{"a"}, []string{"a", "b", "c"}},
+		{RouteRoundRobin, nil, []string{"a", "b", "c"}},
+		{RouteRoundRobin, []string{"a"}, []string{"b", "c", "a"}},
+		{RouteRoundRobin, []string{"a", "b"}, []string{"c", "a", "b"}},
+		{RouteRoundRobin, []string{"c"}, []string{"a", "b", "c"}},
+		// c has never been assigned, so it has waited longest.
+		{RouteLongestIdle, nil, []string{"c", "b", "a"}},
+		{RouteLeastBusy, nil, []string{"c", "b", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			router, err := NewRouter(tt.strategy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.assigned {
+				router.Assigned(testAgent(t, name, 0, 0).ID.Hex())
+			}
+			if got := names(router.Rank(context.Background(), agents)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s after %v: Rank() = %v, want %v", tt.strategy, tt.assigned, got, tt.want)
+			}
+			if got := names(agents); !reflect.DeepEqual(got, []string{"c", "a", "b"}) {
+				t.Errorf("Rank() reordered its input to %v", got)
+			}
+		})
+	}
+}
+
+func TestLeastBusyRouterBreaksTiesByIdleTime(t *testing.T) {
+	agents := []models.Agent{
+		testAgent(t, "a", 1, time.Hour),
+		testAgent(t, "b", 1, 2*time.Hour),
+		testAgent(t, "c", 2, 3*time.Hour),
+	}
+	router, _ := NewRouter(RouteLeastBusy)
+	if got, want := names(router.Rank(context.Background(), agents)), []string{"b", "a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Rank() = %v, want %v", got, want)
+	}
+}
+
+func TestNewRouter(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"", RouteFIFO, false},
+		{"FIFO", RouteFIFO, false},
+		{"round_robin", RouteRoundRobin, false},
+		{"Least_Busy", RouteLeastBusy, false},
+		{"longest_idle", RouteLongestIdle, false},
+		{"random", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, err := NewRouter(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewRouter(%q) error = %v", tt.name, err)
+			}
+			if err == nil && router.Name() != tt.want {
+				t.Errorf("NewRouter(%q).Name() = %q, want %q", tt.name, router.Name(), tt.want)
+			}
+		})
+	}
+}
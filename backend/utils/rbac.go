@@ -0,0 +1,111 @@
+package utils
+
+const (
+	RoleCustomer   = "customer"
+	RoleAgent      = "agent"
+	RoleSupervisor = "supervisor"
+	RoleAdmin      = "admin"
+)
+
+type Permission string
+
+const (
+	PermSessionStart    Permission = "session:start"
+	PermSessionAccess   Permission = "session:access"
+	PermSessionClaim    Permission = "session:claim"
+	PermSessionQueue    Permission = "session:queue"
+	PermSessionReassign Permission = "session:reassign"
+	PermSessionEndAny   Permission = "session:end_any"
+	PermSessionAudit    Permission = "session:audit"
+	PermAgentStatus     Permission = "agent:status"
+	PermAgentViewAll    Permission = "agent:view_all"
+	PermAgentCapacity   Permission = "agent:capacity"
+	PermAgentSkills     Permission = "agent:skills"
+	PermAgentManage     Permission = "agent:manage"
+	PermRoleManage      Permission = "role:manage"
+	PermPromptManage    Permission = "prompt:manage"
+	PermKnowledgeManage Permission = "knowledge:manage"
+	PermRetentionManage Permission = "retention:manage"
+	PermPrivacySelf     Permission = "privacy:self"
+	PermPrivacyManage   Permission = "privacy:manage"
+	PermPIIView         Permission = "pii:view"
+	PermChat            Permission = "chat:send"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleCustomer: {
+		PermSessionStart,
+		PermSessionAccess,
+		PermChat,
+		PermPrivacySelf,
+	},
+	RoleAgent: {
+		PermSessionAccess,
+		PermSessionClaim,
+		PermSessionQueue,
+		PermSessionAudit,
+		PermAgentStatus,
+	},
+	RoleSupervisor: {
+		PermSessionAccess,
+		PermSessionClaim,
+		PermSessionQueue,
+		PermSessionReassign,
+		PermSessionEndAny,
+		PermSessionAudit,
+		PermAgentStatus,
+		PermAgentViewAll,
+		PermAgentCapacity,
+		PermAgentSkills,
+		PermKnowledgeManage,
+		PermPIIView,
+	},
+	RoleAdmin: {
+		PermSessionAccess,
+		PermSessionClaim,
+		PermSessionQueue,
+		PermSessionReassign,
+		PermSessionEndAny,
+		PermSessionAudit,
+		PermAgentStatus,
+		PermAgentViewAll,
+		PermAgentCapacity,
+		PermAgentSkills,
+		PermAgentManage,
+		PermRoleManage,
+		PermPromptManage,
+		PermKnowledgeManage,
+		PermRetentionManage,
+		PermPrivacyManage,
+		PermPIIView,
+	},
+}
+
+func HasPermission(role string, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+func IsStaffRole(role string) bool {
+	return role == RoleAgent || role == RoleSupervisor || role == RoleAdmin
+}
+
+// CustomerRole and StaffRole normalise the role stored on an account
+// document; accounts created before roles existed have none.
+func CustomerRole(stored string) string {
+	if stored == "" {
+		return RoleCustomer
+	}
+	return stored
+}
+
+func StaffRole(stored string) string {
+	if !IsStaffRole(stored) {
+		return RoleAgent
+	}
+	return stored
+}
@@ -0,0 +1,233 @@
+package utils
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Personal data customers paste into chat is masked before it reaches the
+// model, agents or any other screen. Detectors pair a pattern with a
+// validator where one exists, so order numbers and the like are left alone.
+
+const (
+	PIICard  = "card"
+	PIITCKN  = "tckn"
+	PIIIBAN  = "iban"
+	PIIPhone = "phone"
+	PIIEmail = "email"
+)
+
+// PIIDetector finds one kind of personal data in text. Find returns the
+// byte ranges of its matches and Mask what each one is replaced with.
+type PIIDetector interface {
+	Kind() string
+	Find(text string) [][]int
+	Mask(match string) string
+}
+
+// PatternDetector matches Pattern and keeps the matches Valid accepts. The
+// mask keeps the last KeepDigits digits, e.g. of a card number.
+type PatternDetector struct {
+	Name       string
+	Pattern    *regexp.Regexp
+	Valid      func(match string) bool
+	KeepDigits int
+}
+
+func (d *PatternDetector) Kind() string {
+	return d.Name
+}
+
+func (d *PatternDetector) Find(text string) [][]int {
+	var found [][]int
+	for _, loc := range d.Pattern.FindAllStringIndex(text, -1) {
+		if d.Valid == nil || d.Valid(text[loc[0]:loc[1]]) {
+			found = append(found, loc)
+		}
+	}
+	return found
+}
+
+func (d *PatternDetector) Mask(match string) string {
+	label := "[" + strings.ToUpper(d.Name)
+	if digits := onlyDigits(match); d.KeepDigits > 0 && len(digits) > d.KeepDigits {
+		label += " ****" + digits[len(digits)-d.KeepDigits:]
+	}
+	return label + "]"
+}
+
+// Earlier detectors win when matches overlap.
+var piiDetectors = []PIIDetector{
+	&PatternDetector{Name: PIICard, Pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), Valid: validCard, KeepDigits: 4},
+	&PatternDetector{Name: PIITCKN, Pattern: regexp.MustCompile(`\b[1-9]\d{10}\b`), Valid: validTCKN},
+	&PatternDetector{Name: PIIIBAN, Pattern: regexp.MustCompile(`(?i)\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`), Valid: validIBAN},
+	&PatternDetector{Name: PIIPhone, Pattern: regexp.MustCompile(`\+\d[\d .()-]{7,18}\d|\(?\b\d{3,4}\)?[ .-]?\d{3}[ .-]?\d{2}[ .-]?\d{2}\b`), Valid: validPhone},
+	&PatternDetector{Name: PIIEmail, Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)},
+}
+
+// RegisterPIIDetector adds a detector after the built-in ones. Call it before
+// the server starts handling messages.
+func RegisterPIIDetector(d PIIDetector) {
+	piiDetectors = append(piiDetectors, d)
+}
+
+type piiConfig struct {
+	enabled      map[string]bool
+	redactStored bool
+}
+
+var (
+	piiOnce sync.Once
+	pii     piiConfig
+)
+
+// piiSettings reads PII_DETECTORS, a comma-separated list of kinds to look
+// for (all by default, "none" for none), and PII_REDACT_STORED.
+func piiSettings() piiConfig {
+	piiOnce.Do(func() {
+		pii.redactStored = BoolEnv("PII_REDACT_STORED", false)
+		list := strings.TrimSpace(os.Getenv("PII_DETECTORS"))
+		if list == "" {
+			return
+		}
+		pii.enabled = map[string]bool{}
+		for _, kind := range strings.Split(list, ",") {
+			if kind = strings.ToLower(strings.TrimSpace(kind)); kind != "" {
+				pii.enabled[kind] = true
+			}
+		}
+	})
+	return pii
+}
+
+func piiEnabled(kind string) bool {
+	enabled := piiSettings().enabled
+	return enabled == nil || enabled[kind]
+}
+
+// RedactPII masks the personal data in text and returns the kinds it found.
+func RedactPII(text string) (string, []string) {
+	type match struct {
+		start, end int
+		detector   PIIDetector
+	}
+	var matches []match
+	for _, d := range piiDetectors {
+		if !piiEnabled(d.Kind()) {
+			continue
+		}
+		for _, loc := range d.Find(text) {
+			matches = append(matches, match{loc[0], loc[1], d})
+		}
+	}
+	if len(matches) == 0 {
+		return text, nil
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+
+	var b strings.Builder
+	seen := map[string]bool{}
+	var kinds []string
+	pos := 0
+	for _, m := range matches {
+		if m.start < pos {
+			continue
+		}
+		b.WriteString(text[pos:m.start])
+		b.WriteString(m.detector.Mask(text[m.start:m.end]))
+		pos = m.end
+		if kind := m.detector.Kind(); !seen[kind] {
+			seen[kind] = true
+			kinds = append(kinds, kind)
+		}
+	}
+	b.WriteString(text[pos:])
+	sort.Strings(kinds)
+	return b.String(), kinds
+}
+
+func onlyDigits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// validCard applies the Luhn check.
+func validCard(match string) bool {
+	digits := onlyDigits(match)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := range digits {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// validTCKN checks the two check digits of a Turkish identity number.
+func validTCKN(match string) bool {
+	if len(match) != 11 || match[0] == '0' {
+		return false
+	}
+	var d [11]int
+	for i := range d {
+		d[i] = int(match[i] - '0')
+	}
+	odd := d[0] + d[2] + d[4] + d[6] + d[8]
+	even := d[1] + d[3] + d[5] + d[7]
+	if ((odd*7-even)%10+10)%10 != d[9] {
+		return false
+	}
+	return (odd+even+d[9])%10 == d[10]
+}
+
+// validIBAN applies the ISO 13616 mod-97 check.
+func validIBAN(match string) bool {
+	iban := strings.ToUpper(strings.ReplaceAll(match, " ", ""))
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	rem := 0
+	for _, r := range iban[4:] + iban[:4] {
+		switch {
+		case r >= '0' && r <= '9':
+			rem = (rem*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			rem = (rem*100 + int(r-'A'+10)) % 97
+		default:
+			return false
+		}
+	}
+	return rem == 1
+}
+
+// validPhone accepts international numbers written with a + and Turkish
+// numbers, which have ten digits after the trunk or country prefix and start
+// with an area code from 2 to 5.
+func validPhone(match string) bool {
+	digits := onlyDigits(match)
+	if strings.HasPrefix(match, "+") && !strings.HasPrefix(match, "+90") {
+		return len(digits) >= 10 && len(digits) <= 15
+	}
+	switch {
+	case len(digits) == 12 && strings.HasPrefix(digits, "90"):
+		digits = digits[2:]
+	case len(digits) == 11 && digits[0] == '0':
+		digits = digits[1:]
+	}
+	return len(digits) == 10 && digits[0] >= '2' && digits[0] <= '5'
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPIIValidators(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid func(string) bool
+		match string
+		want  bool
+	}{
+		{"card", validCard, "4111 1111 1111 1111", true},
+		{"card with dashes", validCard, "5500-0000-0000-0004", true},
+		{"card failing Luhn", validCard, "4111 1111 1111 1112", false},
+		{"card too short", validCard, "4111 1111 111", false},
+		{"tckn", validTCKN, "10000000146", true},
+		{"tckn wrong tenth digit", validTCKN, "10000000156", false},
+		{"tckn wrong last digit", validTCKN, "10000000147", false},
+		{"tckn leading zero", validTCKN, "01000000146", false},
+		{"iban", validIBAN, "GB82 WEST 1234 5698 7654 32", true},
+		{"iban compact lower case", validIBAN, "tr330006100519786457841326", true},
+		{"iban failing mod 97", validIBAN, "GB82 WEST 1234 5698 7654 33", false},
+		{"iban too short", validIBAN, "GB82 WEST 12", false},
+		{"phone mobile", validPhone, "0532 123 45 67", true},
+		{"phone with country code", validPhone, "+90 532 123 45 67", true},
+		{"phone without prefix", validPhone, "(212) 555 12 34", true},
+		{"phone international", validPhone, "+44 20 7946 0958", true},
+		{"phone bad area code", validPhone, "0632 123 45 67", false},
+		{"phone too short", validPhone, "532 123 45", false},
+		{"phone international too short", validPhone, "+44 123 456", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.valid(tt.match); got != tt.want {
+				t.Errorf("valid(%q) = %v, want %v", tt.match, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactPII(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		want      string
+		wantKinds []string
+	}{
+		{"nothing", "Siparişim nerede?", "Siparişim nerede?", nil},
+		{"order number", "Sipariş no 123456789012345", "Sipariş no 123456789012345", nil},
+		{"card", "Kartım 4111 1111 1111 1111", "Kartım [CARD ****1111]", []string{PIICard}},
+		{"tckn", "TC 10000000146", "TC [TCKN]", []string{PIITCKN}},
+		{"invalid tckn", "TC 10000000147", "TC 10000000147", nil},
+		{"iban", "IBAN: TR33 0006 1005 1978 6457 8413 26", "IBAN: [IBAN]", []string{PIIIBAN}},
+		{"phone", "Beni 0532 123 45 67 numarasından arayın", "Beni [PHONE] numarasından arayın", []string{PIIPhone}},
+		{"email", "mail: ali.veli@example.com", "mail: [EMAIL]", []string{PIIEmail}},
+		{
+			"several kinds",
+			"ali@example.com, 0532 123 45 67, 4111111111111111",
+			"[EMAIL], [PHONE], [CARD ****1111]",
+			[]string{PIICard, PIIEmail, PIIPhone},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, kinds := RedactPII(tt.text)
+			if got != tt.want {
+				t.Errorf("RedactPII(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			if !reflect.DeepEqual(kinds, tt.wantKinds) {
+				t.Errorf("RedactPII(%q) kinds = %v, want %v", tt.text, kinds, tt.wantKinds)
+			}
+		})
+	}
+}
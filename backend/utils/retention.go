@@ -0,0 +1,295 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// A retention policy keeps sessions matching its tenant, mode and status for
+// retainDays after their last activity; empty matchers match anything. The
+// most specific matching policy applies, the longest one among equally
+// specific ones. Sessions no policy matches, open sessions and sessions under
+// legal hold are never purged. Policies therefore only match on the completed
+// status. Conversations saved by /api/chat and /api/agent/send have no
+// tenant or mode and are closed as soon as they are written, so they get the
+// policy a completed session without tenant and mode would.
+
+const purgeReportSample = 100
+
+func RetentionPolicyColl() *mongo.Collection {
+	return MongoDB.Collection("retention_policies")
+}
+
+func UserColl() *mongo.Collection {
+	return MongoDB.Collection("users")
+}
+
+// sessionDataColls hold per-session data keyed by sessionId that goes with
+// the session when it is purged or erased. Anything else derived from a
+// session belongs here too.
+func sessionDataColls() []*mongo.Collection {
+	return []*mongo.Collection{MessageColl, MessageArchiveColl(), SessionEventColl(), PIIVaultColl()}
+}
+
+// SaveRetentionPolicy creates or replaces the policy for its tenant, mode and
+// status.
+func SaveRetentionPolicy(ctx context.Context, policy *models.RetentionPolicy) error {
+	if policy.Mode != "" && policy.Mode != ModeSystem && policy.Mode != ModeHuman {
+		return fmt.Errorf("unknown mode %q", policy.Mode)
+	}
+	if policy.Status != "" && policy.Status != StatusCompleted {
+		return fmt.Errorf("status must be empty or %q, open sessions are never purged", StatusCompleted)
+	}
+	if policy.RetainDays < 1 {
+		return fmt.Errorf("retainDays must be at least 1")
+	}
+	policy.UpdatedAt = time.Now()
+
+	return RetentionPolicyColl().FindOneAndUpdate(ctx,
+		bson.M{"tenant": policy.Tenant, "mode": policy.Mode, "status": policy.Status},
+		bson.M{"$set": bson.M{
+			"retainDays": policy.RetainDays,
+			"updatedAt":  policy.UpdatedAt,
+			"updatedBy":  policy.UpdatedBy,
+		}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(policy)
+}
+
+func RetentionPolicies(ctx context.Context) ([]models.RetentionPolicy, error) {
+	cursor, err := RetentionPolicyColl().Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	policies := []models.RetentionPolicy{}
+	if err := cursor.All(ctx, &policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// RetentionFor returns the policy that applies to a session, if any.
+func RetentionFor(policies []models.RetentionPolicy, session models.Session) (models.RetentionPolicy, bool) {
+	var best models.RetentionPolicy
+	bestScore := -1
+	for _, p := range policies {
+		score := retentionScore(p, session)
+		if score < 0 {
+			continue
+		}
+		if score > bestScore || (score == bestScore && p.RetainDays > best.RetainDays) {
+			best, bestScore = p, score
+		}
+	}
+	return best, bestScore >= 0
+}
+
+// retentionScore counts the matchers a policy sets, or is -1 if one of them
+// does not match the session.
+func retentionScore(p models.RetentionPolicy, session models.Session) int {
+	score := 0
+	for _, m := range [][2]string{{p.Tenant, session.Tenant}, {p.Mode, session.Mode}, {p.Status, session.Status}} {
+		if m[0] == "" {
+			continue
+		}
+		if m[0] != m[1] {
+			return -1
+		}
+		score++
+	}
+	return score
+}
+
+type PurgeReport struct {
+	DryRun        bool           `json:"dryRun"`
+	Sessions      int            `json:"sessions"`
+	Messages      int64          `json:"messages"`
+	Events        int64          `json:"events"`
+	Conversations int64          `json:"conversations"`
+	ByPolicy      map[string]int `json:"byPolicy"`
+	Sample        []string       `json:"sample"`
+}
+
+// PurgeExpiredSessions deletes closed sessions, live or archived, whose
+// retention has run out, together with their messages and other data.
+// Sessions still being archived are skipped. With dryRun nothing is deleted
+// and the report says what would have been.
+func PurgeExpiredSessions(ctx context.Context, dryRun bool) (PurgeReport, error) {
+	report := PurgeReport{DryRun: dryRun, ByPolicy: map[string]int{}, Sample: []string{}}
+
+	policies, err := RetentionPolicies(ctx)
+	if err != nil || len(policies) == 0 {
+		return report, err
+	}
+	shortest := policies[0].RetainDays
+	for _, p := range policies {
+		if p.RetainDays < shortest {
+			shortest = p.RetainDays
+		}
+	}
+	held, err := heldUsers(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	now := time.Now()
+	filter := bson.M{
+		"status":       StatusCompleted,
+		"legalHold":    bson.M{"$ne": true},
+		"userId":       bson.M{"$nin": held},
+		"lastActivity": bson.M{"$lt": now.AddDate(0, 0, -shortest)},
+	}
+	for _, coll := range []*mongo.Collection{SessionColl, SessionArchiveColl()} {
+		cursor, err := coll.Find(ctx, filter)
+		if err != nil {
+			return report, err
+		}
+		var sessions []models.Session
+		if err := cursor.All(ctx, &sessions); err != nil {
+			return report, err
+		}
+
+		for _, s := range sessions {
+			policy, ok := RetentionFor(policies, s)
+			if !ok || !s.LastActivity.Before(now.AddDate(0, 0, -policy.RetainDays)) {
+				continue
+			}
+			if coll != SessionColl {
+				// Still archiving: the archiver would copy it back after
+				// the purge, so leave it for the next run.
+				archiving, err := SessionColl.CountDocuments(ctx, bson.M{"_id": s.ID, "status": StatusArchiving})
+				if err != nil {
+					return report, fmt.Errorf("session %s: %w", s.ID.Hex(), err)
+				}
+				if archiving > 0 {
+					continue
+				}
+			}
+			messages, events, err := purgeSession(ctx, coll, s.ID, dryRun)
+			if err != nil {
+				return report, fmt.Errorf("session %s: %w", s.ID.Hex(), err)
+			}
+			report.Sessions++
+			report.Messages += messages
+			report.Events += events
+			report.ByPolicy[policy.ID.Hex()]++
+			if len(report.Sample) < purgeReportSample {
+				report.Sample = append(report.Sample, s.ID.Hex())
+			}
+		}
+	}
+
+	if policy, ok := RetentionFor(policies, models.Session{Status: StatusCompleted}); ok {
+		n, err := purgeConversations(ctx, now.AddDate(0, 0, -policy.RetainDays), held, dryRun)
+		if err != nil {
+			return report, fmt.Errorf("conversations: %w", err)
+		}
+		report.Conversations = n
+	}
+	return report, nil
+}
+
+// purgeConversations deletes conversations saved with their messages inline
+// whose last activity, or creation for /api/chat records, is before cutoff.
+func purgeConversations(ctx context.Context, cutoff time.Time, held []string, dryRun bool) (int64, error) {
+	return deleteConversations(ctx, bson.M{
+		"legalHold": bson.M{"$ne": true},
+		"userId":    bson.M{"$nin": held},
+		"$or": bson.A{
+			bson.M{"lastActivity": bson.M{"$lt": cutoff}},
+			bson.M{"lastActivity": bson.M{"$exists": false}, "createdAt": bson.M{"$lt": cutoff}},
+		},
+	}, dryRun)
+}
+
+// purgeSession removes the session's data before the session itself, so a
+// purge cut short leaves the session behind to be purged again.
+func purgeSession(ctx context.Context, coll *mongo.Collection, sessionID primitive.ObjectID, dryRun bool) (int64, int64, error) {
+	var messages, events int64
+	for _, data := range sessionDataColls() {
+		var n int64
+		if dryRun {
+			count, err := data.CountDocuments(ctx, bson.M{"sessionId": sessionID})
+			if err != nil {
+				return 0, 0, err
+			}
+			n = count
+		} else {
+			res, err := data.DeleteMany(ctx, bson.M{"sessionId": sessionID})
+			if err != nil {
+				return 0, 0, err
+			}
+			n = res.DeletedCount
+		}
+		switch data.Name() {
+		case MessageColl.Name(), MessageArchiveColl().Name():
+			messages += n
+		case SessionEventColl().Name():
+			events += n
+		}
+	}
+	if !dryRun {
+		if _, err := coll.DeleteOne(ctx, bson.M{"_id": sessionID}); err != nil {
+			return 0, 0, err
+		}
+	}
+	return messages, events, nil
+}
+
+func heldUsers(ctx context.Context) ([]string, error) {
+	cursor, err := UserColl().Find(ctx, bson.M{"legalHold": true},
+		options.Find().SetProjection(bson.M{"email": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var users []struct {
+		Email string `bson:"email"`
+	}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	emails := []string{}
+	for _, u := range users {
+		emails = append(emails, u.Email)
+	}
+	return emails, nil
+}
+
+// SetSessionLegalHold places or lifts a legal hold on a session, wherever it
+// is stored.
+func SetSessionLegalHold(ctx context.Context, sessionID primitive.ObjectID, hold bool) (bool, error) {
+	found := false
+	for _, coll := range []*mongo.Collection{SessionColl, SessionArchiveColl()} {
+		res, err := coll.UpdateOne(ctx, bson.M{"_id": sessionID}, legalHoldUpdate(hold))
+		if err != nil {
+			return false, err
+		}
+		found = found || res.MatchedCount == 1
+	}
+	return found, nil
+}
+
+// SetUserLegalHold places or lifts a legal hold on all of a customer's
+// sessions, including ones they start later.
+func SetUserLegalHold(ctx context.Context, email string, hold bool) (bool, error) {
+	res, err := UserColl().UpdateOne(ctx, bson.M{"email": email}, legalHoldUpdate(hold))
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
+
+func legalHoldUpdate(hold bool) bson.M {
+	if hold {
+		return bson.M{"$set": bson.M{"legalHold": true}}
+	}
+	return bson.M{"$unset": bson.M{"legalHold": ""}}
+}
@@ -0,0 +1,221 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type routingConfig struct {
+	skills          []string
+	defaultLanguage string
+	detectMessages  int
+}
+
+var (
+	routingOnce sync.Once
+	routing     routingConfig
+)
+
+func routingSettings() routingConfig {
+	routingOnce.Do(func() {
+		for _, s := range strings.Split(envOr("ROUTING_SKILLS", "billing,technical,returns"), ",") {
+			if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+				routing.skills = append(routing.skills, s)
+			}
+		}
+		routing.defaultLanguage = strings.ToLower(envOr("ROUTING_DEFAULT_LANGUAGE", "tr"))
+		routing.detectMessages = IntEnv("ROUTING_DETECT_MESSAGES", 3)
+	})
+	return routing
+}
+
+// Skills lists the skills sessions can be routed by.
+func Skills() []string {
+	return routingSettings().skills
+}
+
+func IsSkill(skill string) bool {
+	for _, s := range Skills() {
+		if s == skill {
+			return true
+		}
+	}
+	return false
+}
+
+// RoutingDetectMessages is how many customer messages the AI may look at to
+// tag a session that was started without a skill or language.
+func RoutingDetectMessages() int {
+	return routingSettings().detectMessages
+}
+
+// NormalizeSkills lower-cases and de-duplicates skills, rejecting unknown
+// ones.
+func NormalizeSkills(skills []string) ([]string, error) {
+	out := []string{}
+	for _, s := range skills {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" || contains(out, s) {
+			continue
+		}
+		if !IsSkill(s) {
+			return nil, fmt.Errorf("unknown skill %q", s)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// NormalizeLanguage accepts two-letter ISO 639-1 codes.
+func NormalizeLanguage(lang string) (string, error) {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "" {
+		return "", nil
+	}
+	if len(lang) != 2 || lang[0] < 'a' || lang[0] > 'z' || lang[1] < 'a' || lang[1] > 'z' {
+		return "", fmt.Errorf("invalid language %q", lang)
+	}
+	return lang, nil
+}
+
+func NormalizeLanguages(langs []string) ([]string, error) {
+	out := []string{}
+	for _, l := range langs {
+		l, err := NormalizeLanguage(l)
+		if err != nil {
+			return nil, err
+		}
+		if l != "" && !contains(out, l) {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchScore counts how many of the session's requirements the agent meets,
+// 2 being a full match. A requirement the session does not have is met by
+// everyone. Agents without skills are generalists and match no specific
+// skill; agents without languages speak ROUTING_DEFAULT_LANGUAGE.
+func MatchScore(agent models.Agent, session models.Session) int {
+	score := 0
+	if session.RequiredSkill == "" || contains(agent.Skills, session.RequiredSkill) {
+		score++
+	}
+	languages := agent.Languages
+	if len(languages) == 0 {
+		languages = []string{routingSettings().defaultLanguage}
+	}
+	if session.Language == "" || contains(languages, session.Language) {
+		score++
+	}
+	return score
+}
+
+// PreferMatching orders ranked agents by MatchScore, keeping the router's
+// order among equals. Unless fallback is set, only full matches are kept.
+func PreferMatching(ranked []models.Agent, session models.Session, fallback bool) []models.Agent {
+	out := make([]models.Agent, 0, len(ranked))
+	for _, a := range ranked {
+		if fallback || MatchScore(a, session) == 2 {
+			out = append(out, a)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return MatchScore(out[i], session) > MatchScore(out[j], session)
+	})
+	return out
+}
+
+const routingDetectPrompt = `You route customer support chats to the right team.
+Known skills: %s.
+Reply with only a JSON object of the form {"skill": "...", "language": "..."}:
+"skill" is the one known skill the customer needs, or "" if none clearly applies;
+"language" is the ISO 639-1 code of the language the customer writes in.`
+
+// DetectRouting asks the model which skill and language a conversation
+// needs. Answers it cannot parse come back empty.
+func DetectRouting(ctx context.Context, customerText string) (string, string, error) {
+	resp, err := LLM.Complete(ctx, LLMRequest{
+		System:    fmt.Sprintf(routingDetectPrompt, strings.Join(Skills(), ", ")),
+		Messages:  []LLMMessage{{Role: LLMRoleUser, Text: customerText}},
+		MaxTokens: 60,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	text := resp.Text
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return "", "", nil
+	}
+	var out struct {
+		Skill    string `json:"skill"`
+		Language string `json:"language"`
+	}
+	if json.Unmarshal([]byte(text[start:end+1]), &out) != nil {
+		return "", "", nil
+	}
+
+	skill := strings.ToLower(strings.TrimSpace(out.Skill))
+	if !IsSkill(skill) {
+		skill = ""
+	}
+	lang, err := NormalizeLanguage(out.Language)
+	if err != nil {
+		lang = ""
+	}
+	return skill, lang, nil
+}
+
+// TagSession stores a detected skill and language, but never overwrites
+// what the customer chose or an earlier detection found.
+func TagSession(ctx context.Context, sessionID primitive.ObjectID, skill, lang string) error {
+	if skill != "" {
+		if _, err := SessionColl.UpdateOne(ctx,
+			bson.M{"_id": sessionID, "requiredSkill": bson.M{"$in": bson.A{nil, ""}}},
+			bson.M{"$set": bson.M{"requiredSkill": skill}},
+		); err != nil {
+			return err
+		}
+	}
+	if lang != "" {
+		if _, err := SessionColl.UpdateOne(ctx,
+			bson.M{"_id": sessionID, "language": bson.M{"$in": bson.A{nil, ""}}},
+			bson.M{"$set": bson.M{"language": lang}},
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetAgentSkills replaces the skills and languages an agent is routed by.
+func SetAgentSkills(ctx context.Context, agentID primitive.ObjectID, skills, languages []string) (bool, error) {
+	res, err := AgentColl.UpdateOne(ctx,
+		bson.M{"_id": agentID},
+		bson.M{"$set": bson.M{"skills": skills, "languages": languages}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount == 1, nil
+}
@@ -0,0 +1,81 @@
+package websocket
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"backend/utils"
+)
+
+// BusMessage is a hub delivery relayed between backend instances. Exactly one
+// of UserID, AgentID or Broadcast selects the recipients on the receiving side,
+// unless CancelAIReply asks peers to stop streaming a reply to that session.
+type BusMessage struct {
+	Origin        string `bson:"origin"`
+	UserID        string `bson:"userId,omitempty"`
+	AgentID       string `bson:"agentId,omitempty"`
+	Broadcast     bool   `bson:"broadcast,omitempty"`
+	CancelAIReply string `bson:"cancelAIReply,omitempty"`
+	Data          []byte `bson:"data,omitempty"`
+}
+
+// Backplane carries hub deliveries to every instance. Subscribers also see
+// the messages they published themselves and must skip them by Origin.
+type Backplane interface {
+	Publish(msg BusMessage) error
+	Subscribe(handler func(BusMessage))
+	Close() error
+}
+
+func newBackplane(kind string) (Backplane, error) {
+	switch strings.ToLower(kind) {
+	case "", "memory":
+		return NewMemoryBackplane(), nil
+	case "mongo":
+		bus, err := NewMongoBackplane(utils.MongoDB.Collection("ws_events"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up mongo backplane: %w", err)
+		}
+		log.Println("[WS][BACKPLANE] Relaying deliveries through MongoDB change streams")
+		return bus, nil
+	default:
+		return nil, fmt.Errorf("unknown WS_BACKPLANE %q", kind)
+	}
+}
+
+// MemoryBackplane connects hubs living in the same process. It is the
+// default for single-node deployments.
+type MemoryBackplane struct {
+	mu       sync.RWMutex
+	handlers []func(BusMessage)
+}
+
+func NewMemoryBackplane() *MemoryBackplane {
+	return &MemoryBackplane{}
+}
+
+func (b *MemoryBackplane) Publish(msg BusMessage) error {
+	b.mu.RLock()
+	handlers := append([]func(BusMessage){}, b.handlers...)
+	b.mu.RUnlock()
+
+	for _, handle := range handlers {
+		handle(msg)
+	}
+	return nil
+}
+
+func (b *MemoryBackplane) Subscribe(handler func(BusMessage)) {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, handler)
+	b.mu.Unlock()
+}
+
+func (b *MemoryBackplane) Close() error {
+	b.mu.Lock()
+	b.handlers = nil
+	b.mu.Unlock()
+	return nil
+}
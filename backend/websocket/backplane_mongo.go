@@ -0,0 +1,114 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const busEventTTL = 60
+
+type busEvent struct {
+	BusMessage `bson:",inline"`
+	CreatedAt  time.Time `bson:"createdAt"`
+}
+
+// MongoBackplane relays deliveries through an events collection watched with
+// a change stream, so it needs MongoDB running as a replica set. Events are
+// only kept long enough for instances to pick them up.
+type MongoBackplane struct {
+	coll   *mongo.Collection
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewMongoBackplane(coll *mongo.Collection) (*MongoBackplane, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "createdAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(busEventTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	b := &MongoBackplane{coll: coll}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	return b, nil
+}
+
+func (b *MongoBackplane) Publish(msg BusMessage) error {
+	ctx, cancel := context.WithTimeout(b.ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := b.coll.InsertOne(ctx, busEvent{BusMessage: msg, CreatedAt: time.Now()})
+	return err
+}
+
+func (b *MongoBackplane) Subscribe(handler func(BusMessage)) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		b.watch(handler)
+	}()
+}
+
+// watch follows inserts on the events collection, resuming after the last
+// seen event whenever the stream breaks.
+func (b *MongoBackplane) watch(handler func(BusMessage)) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{"operationType": "insert"}}}}
+	var resumeToken bson.Raw
+
+	for b.ctx.Err() == nil {
+		opts := options.ChangeStream()
+		if resumeToken != nil {
+			opts.SetResumeAfter(resumeToken)
+		}
+
+		stream, err := b.coll.Watch(b.ctx, pipeline, opts)
+		if err != nil {
+			log.Printf("[WS][BACKPLANE] Failed to open change stream: %v", err)
+			resumeToken = nil
+			b.pause()
+			continue
+		}
+
+		for stream.Next(b.ctx) {
+			var change struct {
+				FullDocument busEvent `bson:"fullDocument"`
+			}
+			if err := stream.Decode(&change); err != nil {
+				log.Printf("[WS][BACKPLANE] Failed to decode event: %v", err)
+			} else {
+				handler(change.FullDocument.BusMessage)
+			}
+			resumeToken = stream.ResumeToken()
+		}
+		if err := stream.Err(); err != nil && b.ctx.Err() == nil {
+			log.Printf("[WS][BACKPLANE] Change stream interrupted: %v", err)
+			b.pause()
+		}
+		stream.Close(context.Background())
+	}
+}
+
+func (b *MongoBackplane) pause() {
+	select {
+	case <-b.ctx.Done():
+	case <-time.After(time.Second):
+	}
+}
+
+func (b *MongoBackplane) Close() error {
+	b.cancel()
+	b.wg.Wait()
+	return nil
+}
@@ -0,0 +1,106 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultEscalationNotice = "Sizi bir müşteri temsilcisine aktarıyorum, lütfen bekleyin."
+
+// EscalateSession moves an active AI session to waiting_for_agent, tells the
+// customer and puts the session in front of the agents. It reports false if
+// the session had already left the AI, so concurrent triggers escalate once.
+func EscalateSession(session models.Session, reason string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if utils.SessionState(session) != utils.StateAI {
+		return false
+	}
+	now := time.Now()
+	_, ok, err := utils.TransitionSession(ctx, session, utils.Transition{
+		To:     utils.StateQueued,
+		Actor:  utils.ActorSystem,
+		Reason: reason,
+		Set: bson.M{
+			"escalationReason":   reason,
+			"escalatedAt":        now,
+			"queuedAt":           now,
+			"lowConfidenceCount": 0,
+		},
+	})
+	if err != nil {
+		log.Printf("[ESCALATION][ERROR] Failed to escalate session %s: %v", session.ID.Hex(), err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	log.Printf("[ESCALATION] Session %s escalated: %s", session.ID.Hex(), reason)
+
+	notice := models.Message{
+		SessionID: session.ID,
+		Sender:    "system",
+		Text:      escalationNotice(),
+		Timestamp: now,
+	}
+	if err := utils.InsertSessionMessage(ctx, &notice); err != nil {
+		log.Printf("[ESCALATION][ERROR] Failed to save notice: %v", err)
+	}
+	SendToUser(session.UserID, messageFrame(TypeChatMessage, notice))
+	NotifySessionState(session.UserID, session.ID.Hex(), "system", "waiting_for_agent", "")
+
+	BroadcastSessionUpdate(SessionEvent{
+		SessionID:    session.ID.Hex(),
+		UserID:       session.UserID,
+		Mode:         "system",
+		Status:       "waiting_for_agent",
+		LastActivity: now,
+		Action:       "escalated",
+	})
+	RequestDispatch()
+	return true
+}
+
+func escalationNotice() string {
+	if notice := os.Getenv("ESCALATION_NOTICE"); notice != "" {
+		return notice
+	}
+	return defaultEscalationNotice
+}
+
+// recordConfidence keeps count of low-confidence AI replies in a row and
+// escalates the session once the configured limit is reached.
+func recordConfidence(session models.Session, reply string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if !utils.IsLowConfidence(reply) {
+		if session.LowConfidenceCount > 0 {
+			utils.SessionColl.UpdateOne(ctx, bson.M{"_id": session.ID}, bson.M{"$set": bson.M{"lowConfidenceCount": 0}})
+		}
+		return
+	}
+
+	var updated models.Session
+	err := utils.SessionColl.FindOneAndUpdate(ctx,
+		bson.M{"_id": session.ID},
+		bson.M{"$inc": bson.M{"lowConfidenceCount": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		log.Printf("[ESCALATION][ERROR] Failed to count low-confidence reply on %s: %v", session.ID.Hex(), err)
+		return
+	}
+	if updated.LowConfidenceCount >= utils.LowConfidenceLimit() {
+		EscalateSession(updated, utils.EscalationLowConfidence)
+	}
+}
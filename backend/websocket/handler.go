@@ -5,8 +5,11 @@ import (
 	"backend/utils"
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -18,9 +21,6 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
-var userConns = make(map[string]*websocket.Conn)
-var agentConns = make(map[string]*websocket.Conn)
-
 func cleanupUserSessions(userID string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -52,239 +52,410 @@ func cleanupUserSessions(userID string) {
 
 		for _, session := range sessions {
 			if session.ID != latestSession.ID {
-				utils.SessionColl.DeleteOne(ctx, bson.M{"_id": session.ID})
-				log.Printf("[WS][CLEANUP] User %s için eski session silindi: %s", userID, session.ID.Hex())
+				if ok, err := utils.CloseSession(ctx, session, utils.ActorSystem, utils.CloseDuplicate); err == nil && ok {
+					BroadcastSessionEnd(session.ID.Hex())
+				}
+				log.Printf("[WS][CLEANUP] User %s için eski session kapatıldı: %s", userID, session.ID.Hex())
 			}
 		}
 	}
 }
 
-func keys(m map[string]*websocket.Conn) []string {
-	var k []string
-	for key := range m {
-		k = append(k, key)
-	}
-	return k
-}
-
-func GetUserConn(userID string) *websocket.Conn {
-	return userConns[userID]
-}
-func GetAgentConn(agentID string) *websocket.Conn {
-	return agentConns[agentID]
-}
-
 func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
+	principal, err := utils.ParseToken(utils.TokenFromRequest(r), utils.TokenTypeAccess)
+	if err != nil {
+		log.Println("[WS] Rejected connection without a valid token:", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if utils.AccountErased(r.Context(), principal) {
+		log.Println("[WS] Rejected connection of an erased account")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("WebSocket upgrade error:", err)
 		return
 	}
 	query := r.URL.Query()
-	userID := query.Get("userId")
-	agentID := query.Get("agentId")
 	sessionID := query.Get("sessionId")
 
+	var userID, agentID string
+	if utils.IsStaffRole(principal.Role) {
+		agentID = principal.ID
+	} else {
+		userID = principal.Email
+	}
+
 	if userID != "" {
 		cleanupUserSessions(userID)
 	}
 
+	var session *models.Session
+	if sessionID != "" {
+		session = findResumableSession(sessionID, userID, agentID)
+	}
+
+	// Messages stored while the client was away are queued ahead of live
+	// traffic. Anything stored between the replay query and registration is
+	// picked up by the catch-up below; the client drops duplicates by seq.
+	var replay []models.Message
+	lastSeq, resuming := parseLastSeq(query.Get("lastSeq"))
+	if session != nil && resuming {
+		replay, err = utils.FindSessionMessages(context.Background(), session.ID, lastSeq)
+		if err != nil {
+			log.Printf("[WS][ERROR] Failed to load missed messages for session %s: %v", sessionID, err)
+		}
+	}
+
+	client := newClient(conn, userID, agentID, len(replay))
+
 	if userID != "" {
-		userConns[userID] = conn
 		log.Printf("[WS] User connected: %s, Session: %s", userID, sessionID)
-		if sessionID != "" {
-			sessionObjId, _ := primitive.ObjectIDFromHex(sessionID)
-			var session models.Session
-			err := utils.SessionColl.FindOne(context.TODO(), bson.M{"_id": sessionObjId}).Decode(&session)
-			if err == nil {
-				out := map[string]interface{}{
-					"sender":        "system",
-					"mode":          session.Mode,
-					"status":        session.Status,
-					"assignedAgent": session.AssignedAgent,
-				}
-				jsonData, _ := json.Marshal(out)
-				conn.WriteMessage(websocket.TextMessage, jsonData)
-				log.Printf("[WS] Sent session info to user: %s", userID)
+		if session != nil {
+			client.queue(sessionStateFrame(sessionID, session.Mode, session.Status, session.AssignedAgent))
+			log.Printf("[WS] Sent session info to user: %s", userID)
+		}
+	}
+
+	for _, msg := range replay {
+		client.queue(messageFrame(TypeChatMessage, msg))
+		lastSeq = msg.Seq
+	}
+
+	hub.register <- client
+	go client.writePump()
+
+	if session != nil && resuming {
+		if len(replay) > 0 {
+			log.Printf("[WS] Replayed %d missed messages on session %s", len(replay), sessionID)
+		}
+		catchUp, err := utils.FindSessionMessages(context.Background(), session.ID, lastSeq)
+		if err == nil {
+			for _, msg := range catchUp {
+				hub.SendToClient(client, messageFrame(TypeChatMessage, msg))
 			}
 		}
 	}
 
+	if userID != "" {
+		presence.setUser(userID, PresenceOnline)
+		if session != nil && session.Status == "waiting_for_agent" {
+			RequestDispatch()
+		}
+	}
+	if agentID != "" {
+		presence.setAgent(agentID, PresenceOnline)
+	}
+
 	if agentID != "" {
-		agentConns[agentID] = conn
 		log.Printf("[WS] Agent connected: %s", agentID)
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		sessions, _ := utils.SessionColl.Find(ctx, bson.M{"assignedAgent": agentID, "status": "active"})
-		for sessions.Next(ctx) {
-			var s models.Session
-			if err := sessions.Decode(&s); err == nil {
-				userConn := GetUserConn(s.UserID)
-				if userConn != nil {
-					out := map[string]interface{}{
-						"sender":        "system",
-						"mode":          "human",
-						"status":        "active",
-						"assignedAgent": agentID,
+		sessions, err := utils.SessionColl.Find(ctx, bson.M{"assignedAgent": agentID, "status": "active"})
+		if err == nil {
+			for sessions.Next(ctx) {
+				var s models.Session
+				if err := sessions.Decode(&s); err == nil {
+					out := sessionStateFrame(s.ID.Hex(), "human", "active", agentID)
+					if SendToUser(s.UserID, out) {
+						log.Printf("[WS] Notified user %s about agent assignment", s.UserID)
 					}
-					jsonData, _ := json.Marshal(out)
-					userConn.WriteMessage(websocket.TextMessage, jsonData)
-					log.Printf("[WS] Notified user %s about agent assignment", s.UserID)
 				}
 			}
+			sessions.Close(ctx)
 		}
 	}
 
 	defer func() {
+		remaining := hub.Unregister(client)
 		if userID != "" {
-			delete(userConns, userID)
-			log.Printf("[WS] User disconnected: %s", userID)
+			log.Printf("[WS] User disconnected: %s (%d connections left)", userID, remaining)
+			if remaining == 0 {
+				presence.setUser(userID, PresenceOffline)
+			}
 		}
 		if agentID != "" {
-			delete(agentConns, agentID)
-			log.Printf("[WS] Agent disconnected: %s", agentID)
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-
-			agentObjId, err := primitive.ObjectIDFromHex(agentID)
-			if err == nil {
-				utils.AgentColl.UpdateOne(ctx, bson.M{"_id": agentObjId}, bson.M{"$set": bson.M{"status": "available"}})
+			log.Printf("[WS] Agent disconnected: %s (%d connections left)", agentID, remaining)
+			if remaining == 0 {
+				presence.setAgent(agentID, PresenceOffline)
+				log.Printf("[WS] Agent %s disconnected - keeping sessions in human mode", agentID)
 			}
-
-			log.Printf("[WS] Agent %s disconnected - keeping sessions in human mode", agentID)
 		}
-		conn.Close()
 	}()
 
-	for {
-		_, message, err := conn.ReadMessage()
-		if err != nil {
-			log.Println("WebSocket read error:", err)
-			break
-		}
-		HandleWebSocketMessage(message)
+	client.readPump(func(data []byte) {
+		HandleWebSocketMessage(client, data)
+	})
+}
+
+// findResumableSession returns the session only if the connecting principal
+// may read it: customers their own sessions, agents the ones assigned to them.
+func findResumableSession(sessionID, userID, agentID string) *models.Session {
+	sessionObjId, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return nil
+	}
+
+	var session models.Session
+	if err := utils.SessionColl.FindOne(context.TODO(), bson.M{"_id": sessionObjId}).Decode(&session); err != nil {
+		return nil
 	}
+	if userID != "" && session.UserID != userID {
+		return nil
+	}
+	if agentID != "" && session.AssignedAgent != agentID {
+		return nil
+	}
+	return &session
 }
 
-func HandleWebSocketMessage(messageData []byte) {
-	var incoming struct {
-		SessionID string `json:"sessionId"`
-		Sender    string `json:"sender"`
-		Message   string `json:"message"`
+func parseLastSeq(raw string) (int64, bool) {
+	if raw == "" {
+		return 0, false
+	}
+	seq, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, false
 	}
+	return seq, true
+}
 
-	if err := json.Unmarshal(messageData, &incoming); err != nil {
-		log.Println("Invalid message format")
+func HandleWebSocketMessage(c *Client, messageData []byte) {
+	var in Envelope
+	if err := json.Unmarshal(messageData, &in); err != nil {
+		hub.SendToClient(c, errorFrame("", "", ErrCodeBadFrame, "Frame is not valid JSON"))
+		return
+	}
+	if in.Version != ProtocolVersion {
+		hub.SendToClient(c, errorFrame(in.ID, in.SessionID, ErrCodeUnsupportedVersion, "Unsupported protocol version"))
+		return
+	}
+	if in.Type != TypeChatMessage {
+		hub.SendToClient(c, errorFrame(in.ID, in.SessionID, ErrCodeUnknownType, "Unknown frame type: "+in.Type))
 		return
 	}
 
-	log.Printf("[WS] Received message from %s: %s", incoming.Sender, incoming.Message)
+	var payload ChatMessageIn
+	if err := json.Unmarshal(in.Payload, &payload); err != nil {
+		hub.SendToClient(c, errorFrame(in.ID, in.SessionID, ErrCodeInvalidPayload, "Invalid chat_message payload"))
+		return
+	}
+	text := strings.TrimSpace(payload.Text)
+	if text == "" || len(text) > maxMessageLength {
+		hub.SendToClient(c, errorFrame(in.ID, in.SessionID, ErrCodeInvalidPayload, "Message text must be 1-4000 characters"))
+		return
+	}
 
-	sessionID, _ := primitive.ObjectIDFromHex(incoming.SessionID)
+	sessionID, err := primitive.ObjectIDFromHex(in.SessionID)
+	if err != nil {
+		hub.SendToClient(c, errorFrame(in.ID, in.SessionID, ErrCodeSessionNotFound, "Invalid session ID"))
+		return
+	}
 	var session models.Session
-	err := utils.SessionColl.FindOne(context.TODO(), bson.M{"_id": sessionID}).Decode(&session)
+	err = utils.SessionColl.FindOne(context.TODO(), bson.M{"_id": sessionID}).Decode(&session)
 	if err != nil {
-		log.Println("Session not found:", err)
+		hub.SendToClient(c, errorFrame(in.ID, in.SessionID, ErrCodeSessionNotFound, "Session not found"))
 		return
 	}
 
+	sender := c.sender()
+	switch sender {
+	case "user":
+		if session.UserID != c.userID {
+			hub.SendToClient(c, errorFrame(in.ID, in.SessionID, ErrCodeForbidden, "Not your session"))
+			return
+		}
+	case "agent":
+		if session.Mode != "human" || session.AssignedAgent != c.agentID {
+			hub.SendToClient(c, errorFrame(in.ID, in.SessionID, ErrCodeForbidden, "Session is not assigned to you"))
+			return
+		}
+	}
+
+	// Only open sessions take messages; anything else would reopen a
+	// completed session behind the lifecycle's back.
+	switch utils.SessionState(session) {
+	case utils.StateAI, utils.StateQueued, utils.StateAgent:
+	default:
+		hub.SendToClient(c, errorFrame(in.ID, in.SessionID, ErrCodeSessionClosed, "Session is closed"))
+		return
+	}
+
+	log.Printf("[WS] Received message from %s on session %s", sender, in.SessionID)
+
 	utils.SessionColl.UpdateOne(context.TODO(), bson.M{"_id": sessionID}, bson.M{"$set": bson.M{"lastActivity": time.Now()}})
 
 	msg := models.Message{
 		SessionID: sessionID,
-		Sender:    incoming.Sender,
-		Text:      incoming.Message,
+		Sender:    sender,
+		Text:      text,
 		Timestamp: time.Now(),
 	}
-	_, err = utils.MessageColl.InsertOne(context.Background(), msg)
-	if err != nil {
+	if err := utils.InsertSessionMessage(context.Background(), &msg); err != nil {
 		log.Println("Failed to save message:", err)
+		if errors.Is(err, utils.ErrSessionArchived) {
+			hub.SendToClient(c, errorFrame(in.ID, in.SessionID, ErrCodeSessionClosed, "Session is closed"))
+		} else {
+			hub.SendToClient(c, errorFrame(in.ID, in.SessionID, ErrCodeInternal, "Message could not be saved"))
+		}
+		return
 	}
+	out := messageFrame(TypeChatMessage, msg)
 
 	if session.Mode == "system" {
-		if incoming.Sender == "user" {
-			userOut := map[string]string{
-				"sender":  "user",
-				"message": incoming.Message,
-			}
-			userJsonData, _ := json.Marshal(userOut)
-			userConn := GetUserConn(session.UserID)
-			if userConn != nil {
-				userConn.WriteMessage(websocket.TextMessage, userJsonData)
-				log.Printf("[WS] Echoed user message in system mode: %s", session.UserID)
-			} else {
-				log.Printf("[WS] User connection not found for echo in system mode: %s", session.UserID)
-			}
+		if SendToUser(session.UserID, out) {
+			log.Printf("[WS] Echoed user message in system mode: %s", session.UserID)
+		} else {
+			log.Printf("[WS] User connection not found for echo in system mode: %s", session.UserID)
 		}
 
-		log.Printf("[WS] Processing system message for session: %s", sessionID.Hex())
-		reply, err := utils.AskGemini(incoming.Message)
-		if err != nil {
-			log.Println("System error:", err)
+		if session.Status == "waiting_for_agent" {
+			log.Printf("[WS] Session %s is waiting for an agent, holding AI reply", sessionID.Hex())
 			return
 		}
-
-		log.Printf("[WS] Gemini reply: %s", reply)
-
-		systemMsg := models.Message{
-			SessionID: sessionID,
-			Sender:    "system",
-			Text:      reply,
-			Timestamp: time.Now(),
+		if reason, ok := utils.DetectEscalation(text); ok {
+			// Tag first so the dispatcher can route the escalation by skill.
+			tagSession(session)
+			EscalateSession(session, reason)
+			return
 		}
-		_, _ = utils.MessageColl.InsertOne(context.Background(), systemMsg)
+		go tagSession(session)
+
+		// The reply streams in its own goroutine so readPump keeps reading,
+		// and answering pings, however long the model takes.
+		ctx, done := aiReplies.start(sessionID.Hex())
+		go func() {
+			defer done()
+			streamAIReply(ctx, c, in, session, msg)
+		}()
+		return
+	}
 
-		out := map[string]string{
-			"sender":  "system",
-			"message": reply,
+	if sender == "user" {
+		if SendToAgent(session.AssignedAgent, out) {
+			log.Printf("[WS] Sent user message to agent: %s", session.AssignedAgent)
+		} else {
+			log.Printf("[WS] Agent connection not found for: %s", session.AssignedAgent)
 		}
-		jsonData, _ := json.Marshal(out)
-		userConn := GetUserConn(session.UserID)
-		if userConn != nil {
-			userConn.WriteMessage(websocket.TextMessage, jsonData)
-			log.Printf("[WS] Sent system reply to user: %s", session.UserID)
+
+		if SendToUser(session.UserID, out) {
+			log.Printf("[WS] Echoed user message back to user: %s", session.UserID)
 		} else {
-			log.Printf("[WS] User connection not found for: %s", session.UserID)
+			log.Printf("[WS] User connection not found for echo: %s", session.UserID)
 		}
 	} else {
-		out := map[string]string{
-			"sender":  incoming.Sender,
-			"message": incoming.Message,
+		if SendToUser(session.UserID, out) {
+			log.Printf("[WS] Sent agent message to user: %s", session.UserID)
+		} else {
+			log.Println("[WS] User connection not found for agent message:", session.UserID)
 		}
-		jsonData, _ := json.Marshal(out)
-		if incoming.Sender == "user" {
-			agentConn := GetAgentConn(session.AssignedAgent)
-			if agentConn != nil {
-				agentConn.WriteMessage(websocket.TextMessage, jsonData)
-				log.Printf("[WS] Sent user message to agent: %s", session.AssignedAgent)
-			} else {
-				log.Printf("[WS] Agent connection not found for: %s", session.AssignedAgent)
-			}
+	}
+}
 
-			userConn := GetUserConn(session.UserID)
-			if userConn != nil {
-				userConn.WriteMessage(websocket.TextMessage, jsonData)
-				log.Printf("[WS] Echoed user message back to user: %s", session.UserID)
-			} else {
-				log.Printf("[WS] User connection not found for echo: %s", session.UserID)
-			}
-		} else {
-			userConn := GetUserConn(session.UserID)
-			if userConn != nil {
-				userConn.WriteMessage(websocket.TextMessage, jsonData)
-				log.Printf("[WS] Sent agent message to user: %s", session.UserID)
-			} else {
-				log.Println("[WS] userConn nil! session.UserID:", session.UserID, "userConns keys:", keys(userConns))
-			}
+// streamAIReply answers a customer message in a system-mode session. ctx is
+// cancelled when an agent takes the session over.
+func streamAIReply(ctx context.Context, c *Client, in Envelope, session models.Session, msg models.Message) {
+	sessionID := session.ID
+
+	log.Printf("[WS] Processing system message for session: %s", sessionID.Hex())
+	history, err := utils.FindSessionMessages(context.Background(), sessionID, 0)
+	if err != nil {
+		log.Printf("[WS][ERROR] Failed to load context for session %s: %v", sessionID.Hex(), err)
+	}
+	if len(history) == 0 || history[len(history)-1].ID != msg.ID {
+		history = append(history, msg)
+	}
+
+	system := utils.SystemPrompt(ctx, session.Tenant, session.Channel, session.UserID, history)
+	knowledge, err := utils.RetrieveForTurn(ctx, msg.Text)
+	if err != nil {
+		log.Printf("[WS][ERROR] Knowledge base lookup failed for session %s: %v", sessionID.Hex(), err)
+	}
+	if len(knowledge) > 0 {
+		system += "\n\n" + utils.KnowledgePrompt(knowledge)
+	}
+
+	replyID := primitive.NewObjectID()
+	deltas := newDeltaStream(session.UserID, in.SessionID, replyID)
+	resp, err := utils.LLM.Stream(ctx, utils.LLMRequest{
+		System:   system,
+		Messages: utils.ConversationForLLM(history, utils.LLMContextTokens),
+	}, func(delta string) error {
+		deltas.send(delta)
+		return nil
+	})
+	deltas.flush()
+	// A takeover can land before the stream is registered or on another
+	// instance, so the session's mode has the final say.
+	if err == nil && !stillSystemMode(sessionID) {
+		err = context.Canceled
+	}
+	if err != nil {
+		if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+			log.Printf("[WS] AI reply cancelled for session %s", sessionID.Hex())
+			cancelled := newFrame(TypeAICancelled, in.SessionID, nil)
+			cancelled.ID = replyID.Hex()
+			SendToUser(session.UserID, cancelled)
+			return
 		}
+		log.Println("System error:", err)
+		hub.SendToClient(c, errorFrame(in.ID, in.SessionID, ErrCodeInternal, "Assistant is unavailable"))
+		return
+	}
+	reply := resp.Text
+
+	// The reply can repeat personal data the customer sent, so only its
+	// size is logged.
+	log.Printf("[WS] %s reply on session %s (%d prompt + %d completion tokens)", resp.Model, sessionID.Hex(), resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+
+	systemMsg := models.Message{
+		ID:        replyID,
+		SessionID: sessionID,
+		Sender:    "system",
+		Text:      reply,
+		Timestamp: time.Now(),
+		Citations: utils.CitedArticles(knowledge),
+	}
+	if err := utils.InsertSessionMessage(context.Background(), &systemMsg); err != nil {
+		log.Println("Failed to save system reply:", err)
+	}
+
+	if SendToUser(session.UserID, messageFrame(TypeAIComplete, systemMsg)) {
+		log.Printf("[WS] Sent system reply to user: %s", session.UserID)
+	} else {
+		log.Printf("[WS] User connection not found for: %s", session.UserID)
+	}
+
+	recordConfidence(session, reply)
+}
+
+func stillSystemMode(sessionID primitive.ObjectID) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var session models.Session
+	err := utils.SessionColl.FindOne(ctx, bson.M{"_id": sessionID}).Decode(&session)
+	return err == nil && session.Mode == "system"
+}
+
+func NotifySessionState(userID, sessionID, mode, status, assignedAgent string) bool {
+	return SendToUser(userID, sessionStateFrame(sessionID, mode, status, assignedAgent))
+}
+
+func SendHistory(agentID string, messages []models.Message) {
+	for _, msg := range messages {
+		SendToAgent(agentID, messageFrame(TypeHistory, msg))
 	}
 }
 
@@ -304,94 +475,22 @@ func NotifySessionEnded(sessionID string) {
 		return
 	}
 
-	userConn := GetUserConn(session.UserID)
-	if userConn != nil {
-		out := map[string]interface{}{
-			"sender": "system",
-			"status": "completed",
-		}
-		jsonData, _ := json.Marshal(out)
-		userConn.WriteMessage(websocket.TextMessage, jsonData)
+	if NotifySessionState(session.UserID, sessionID, session.Mode, "completed", session.AssignedAgent) {
 		log.Printf("[WS] Notified user %s about session end", session.UserID)
 	}
 }
 
-func BroadcastNewSession(sessionData map[string]interface{}) {
-	message := map[string]interface{}{
-		"type":    "new_session",
-		"payload": sessionData,
-	}
-	jsonData, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("[WS] Failed to marshal new session: %v", err)
-		return
-	}
-
-	count := 0
-	for agentID, conn := range agentConns {
-		if conn != nil {
-			err := conn.WriteMessage(websocket.TextMessage, jsonData)
-			if err != nil {
-				log.Printf("[WS] Failed to send new session to agent %s: %v", agentID, err)
-				delete(agentConns, agentID)
-			} else {
-				count++
-			}
-		}
-	}
+func BroadcastNewSession(event SessionEvent) {
+	count := Broadcast(newFrame(TypeNewSession, event.SessionID, event))
 	log.Printf("[WS] Broadcasted new session to %d agents", count)
 }
 
-func BroadcastSessionUpdate(sessionUpdate map[string]interface{}) {
-	message := map[string]interface{}{
-		"type":    "session_update",
-		"payload": sessionUpdate,
-	}
-	jsonData, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("[WS] Failed to marshal session update: %v", err)
-		return
-	}
-
-	count := 0
-	for agentID, conn := range agentConns {
-		if conn != nil {
-			err := conn.WriteMessage(websocket.TextMessage, jsonData)
-			if err != nil {
-				log.Printf("[WS] Failed to send session update to agent %s: %v", agentID, err)
-				delete(agentConns, agentID)
-			} else {
-				count++
-			}
-		}
-	}
+func BroadcastSessionUpdate(event SessionEvent) {
+	count := Broadcast(newFrame(TypeSessionUpdate, event.SessionID, event))
 	log.Printf("[WS] Broadcasted session update to %d agents", count)
 }
 
 func BroadcastSessionEnd(sessionID string) {
-	message := map[string]interface{}{
-		"type": "session_end",
-		"payload": map[string]interface{}{
-			"sessionId": sessionID,
-		},
-	}
-	jsonData, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("[WS] Failed to marshal session end: %v", err)
-		return
-	}
-
-	count := 0
-	for agentID, conn := range agentConns {
-		if conn != nil {
-			err := conn.WriteMessage(websocket.TextMessage, jsonData)
-			if err != nil {
-				log.Printf("[WS] Failed to send session end to agent %s: %v", agentID, err)
-				delete(agentConns, agentID)
-			} else {
-				count++
-			}
-		}
-	}
+	count := Broadcast(newFrame(TypeSessionEnd, sessionID, SessionEvent{SessionID: sessionID, Status: "completed"}))
 	log.Printf("[WS] Broadcasted session end to %d agents", count)
 }
@@ -0,0 +1,388 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	sendQueueSize = 64
+	writeWait     = 10 * time.Second
+)
+
+type Client struct {
+	conn    *websocket.Conn
+	send    chan []byte
+	userID  string
+	agentID string
+	closed  bool
+	gone    chan int
+
+	lastActive atomic.Int64
+}
+
+type delivery struct {
+	client  *Client
+	userID  string
+	agentID string
+	data    []byte
+	result  chan int
+}
+
+type connSet map[*Client]struct{}
+
+type Hub struct {
+	id         string
+	bus        Backplane
+	users      map[string]connSet
+	agents     map[string]connSet
+	register   chan *Client
+	unregister chan *Client
+	broadcast  chan delivery
+	direct     chan delivery
+	activity   chan chan activitySnapshot
+}
+
+// activitySnapshot maps each connected principal to the most recent time any
+// of its connections showed client activity.
+type activitySnapshot struct {
+	users  map[string]time.Time
+	agents map[string]time.Time
+}
+
+var hub = NewHub()
+
+func init() {
+	go hub.Run()
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		id:         primitive.NewObjectID().Hex(),
+		users:      make(map[string]connSet),
+		agents:     make(map[string]connSet),
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+		broadcast:  make(chan delivery),
+		direct:     make(chan delivery),
+		activity:   make(chan chan activitySnapshot),
+	}
+}
+
+// UseBackplane relays this hub's deliveries to other instances and delivers
+// theirs to local connections. It must be called before the hub carries
+// traffic.
+func (h *Hub) UseBackplane(b Backplane) {
+	h.bus = b
+	b.Subscribe(h.receive)
+}
+
+func (h *Hub) receive(msg BusMessage) {
+	if msg.Origin == h.id {
+		return
+	}
+	switch {
+	case msg.CancelAIReply != "":
+		aiReplies.cancel(msg.CancelAIReply)
+	case msg.Broadcast:
+		h.deliver(delivery{data: msg.Data}, h.broadcast)
+	case msg.UserID != "":
+		h.deliver(delivery{userID: msg.UserID, data: msg.Data}, h.direct)
+	case msg.AgentID != "":
+		h.deliver(delivery{agentID: msg.AgentID, data: msg.Data}, h.direct)
+	}
+}
+
+func (h *Hub) publish(msg BusMessage) {
+	if h.bus == nil {
+		return
+	}
+	msg.Origin = h.id
+	if err := h.bus.Publish(msg); err != nil {
+		log.Printf("[WS][BACKPLANE] Failed to publish: %v", err)
+	}
+}
+
+// newClient sizes the send queue so that backlog frames can be queued before
+// registration without crowding out live traffic.
+func newClient(conn *websocket.Conn, userID, agentID string, backlog int) *Client {
+	c := &Client{
+		conn:    conn,
+		send:    make(chan []byte, sendQueueSize+backlog),
+		userID:  userID,
+		agentID: agentID,
+		gone:    make(chan int, 1),
+	}
+	c.touch()
+	return c
+}
+
+func (c *Client) sender() string {
+	if c.agentID != "" {
+		return "agent"
+	}
+	return "user"
+}
+
+func (c *Client) touch() {
+	c.lastActive.Store(time.Now().UnixNano())
+}
+
+func (h *Hub) Run() {
+	for {
+		select {
+		case c := <-h.register:
+			if c.userID != "" {
+				add(h.users, c.userID, c)
+			}
+			if c.agentID != "" {
+				add(h.agents, c.agentID, c)
+			}
+
+		case c := <-h.unregister:
+			h.remove(c)
+			if c.agentID != "" {
+				c.gone <- len(h.agents[c.agentID])
+			} else {
+				c.gone <- len(h.users[c.userID])
+			}
+
+		case d := <-h.broadcast:
+			count := 0
+			for _, set := range h.agents {
+				count += h.fanOut(set, d.data)
+			}
+			d.result <- count
+
+		case d := <-h.direct:
+			if d.client != nil {
+				if !d.client.closed && h.enqueue(d.client, d.data) {
+					d.result <- 1
+				} else {
+					d.result <- 0
+				}
+			} else if d.userID != "" {
+				d.result <- h.fanOut(h.users[d.userID], d.data)
+			} else {
+				d.result <- h.fanOut(h.agents[d.agentID], d.data)
+			}
+
+		case reply := <-h.activity:
+			reply <- activitySnapshot{
+				users:  latestActivity(h.users),
+				agents: latestActivity(h.agents),
+			}
+		}
+	}
+}
+
+// enqueue never blocks the hub: a client whose queue is full is too slow to
+// keep up and gets disconnected instead.
+func (h *Hub) enqueue(c *Client, data []byte) bool {
+	select {
+	case c.send <- data:
+		return true
+	default:
+		log.Printf("[WS] Send queue full, dropping connection (user=%s agent=%s)", c.userID, c.agentID)
+		h.remove(c)
+		return false
+	}
+}
+
+func (h *Hub) fanOut(set connSet, data []byte) int {
+	count := 0
+	for c := range set {
+		if h.enqueue(c, data) {
+			count++
+		}
+	}
+	return count
+}
+
+func latestActivity(m map[string]connSet) map[string]time.Time {
+	out := make(map[string]time.Time, len(m))
+	for id, set := range m {
+		for c := range set {
+			t := time.Unix(0, c.lastActive.Load())
+			if t.After(out[id]) {
+				out[id] = t
+			}
+		}
+	}
+	return out
+}
+
+func (h *Hub) Activity() activitySnapshot {
+	reply := make(chan activitySnapshot, 1)
+	h.activity <- reply
+	return <-reply
+}
+
+func add(m map[string]connSet, id string, c *Client) {
+	if m[id] == nil {
+		m[id] = make(connSet)
+	}
+	m[id][c] = struct{}{}
+}
+
+func drop(m map[string]connSet, id string, c *Client) {
+	if set, ok := m[id]; ok {
+		delete(set, c)
+		if len(set) == 0 {
+			delete(m, id)
+		}
+	}
+}
+
+func (h *Hub) remove(c *Client) {
+	if c.userID != "" {
+		drop(h.users, c.userID, c)
+	}
+	if c.agentID != "" {
+		drop(h.agents, c.agentID, c)
+	}
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
+
+// Unregister removes c and returns how many connections its principal still
+// has open.
+func (h *Hub) Unregister(c *Client) int {
+	h.unregister <- c
+	return <-c.gone
+}
+
+func (h *Hub) deliver(d delivery, ch chan delivery) int {
+	d.result = make(chan int, 1)
+	ch <- d
+	return <-d.result
+}
+
+// SendToUser and SendToAgent report whether the frame reached a connection on
+// this instance; peers on the backplane deliver it to their own connections.
+func (h *Hub) SendToUser(userID string, msg interface{}) bool {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("[WS] Failed to marshal message for user %s: %v", userID, err)
+		return false
+	}
+	h.publish(BusMessage{UserID: userID, Data: data})
+	return h.deliver(delivery{userID: userID, data: data}, h.direct) > 0
+}
+
+// sendLocalToUser delivers to the user's connections on this instance only.
+func (h *Hub) sendLocalToUser(userID string, data []byte) bool {
+	return h.deliver(delivery{userID: userID, data: data}, h.direct) > 0
+}
+
+func (h *Hub) SendToAgent(agentID string, msg interface{}) bool {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("[WS] Failed to marshal message for agent %s: %v", agentID, err)
+		return false
+	}
+	h.publish(BusMessage{AgentID: agentID, Data: data})
+	return h.deliver(delivery{agentID: agentID, data: data}, h.direct) > 0
+}
+
+func (h *Hub) SendToClient(c *Client, msg interface{}) bool {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("[WS] Failed to marshal message: %v", err)
+		return false
+	}
+	return h.deliver(delivery{client: c, data: data}, h.direct) > 0
+}
+
+func (h *Hub) Broadcast(msg interface{}) int {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("[WS] Failed to marshal broadcast: %v", err)
+		return 0
+	}
+	h.publish(BusMessage{Broadcast: true, Data: data})
+	return h.deliver(delivery{data: data}, h.broadcast)
+}
+
+// queue is only safe before the client is registered with the hub; after
+// that the hub owns the send channel.
+func (c *Client) queue(msg interface{}) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+	}
+}
+
+func (c *Client) writePump() {
+	ticker := time.NewTicker(heartbeat.pingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case data, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Printf("[WS] Write error (user=%s agent=%s): %v", c.userID, c.agentID, err)
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				log.Printf("[WS] Ping failed (user=%s agent=%s): %v", c.userID, c.agentID, err)
+				return
+			}
+		}
+	}
+}
+
+// readPump blocks until the connection fails or the peer stops answering
+// pings within the pong timeout, handing each inbound frame to onMessage.
+func (c *Client) readPump(onMessage func([]byte)) {
+	c.conn.SetReadDeadline(time.Now().Add(heartbeat.pongTimeout))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(heartbeat.pongTimeout))
+	})
+
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("[WS] Read error (user=%s agent=%s): %v", c.userID, c.agentID, err)
+			}
+			return
+		}
+		c.conn.SetReadDeadline(time.Now().Add(heartbeat.pongTimeout))
+		c.touch()
+		onMessage(message)
+	}
+}
+
+func SendToUser(userID string, msg interface{}) bool {
+	return hub.SendToUser(userID, msg)
+}
+
+func SendToAgent(agentID string, msg interface{}) bool {
+	return hub.SendToAgent(agentID, msg)
+}
+
+func Broadcast(msg interface{}) int {
+	return hub.Broadcast(msg)
+}
@@ -0,0 +1,330 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"backend/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+)
+
+type heartbeatConfig struct {
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+	awayAfter    time.Duration
+}
+
+var heartbeat = heartbeatConfig{
+	pingInterval: 30 * time.Second,
+	pongTimeout:  60 * time.Second,
+	awayAfter:    5 * time.Minute,
+}
+
+// Init reads the heartbeat, backplane and queue settings from the
+// environment and starts the presence tracker and queue dispatcher. It must
+// run after the environment and Mongo are set up.
+func Init() error {
+	heartbeat.pingInterval = utils.DurationEnv("WS_PING_INTERVAL", heartbeat.pingInterval)
+	heartbeat.pongTimeout = utils.DurationEnv("WS_PONG_TIMEOUT", heartbeat.pongTimeout)
+	heartbeat.awayAfter = utils.DurationEnv("PRESENCE_AWAY_AFTER", heartbeat.awayAfter)
+	if heartbeat.pongTimeout <= heartbeat.pingInterval {
+		heartbeat.pongTimeout = heartbeat.pingInterval * 2
+		log.Printf("[WS][WARN] WS_PONG_TIMEOUT must exceed WS_PING_INTERVAL, using %s", heartbeat.pongTimeout)
+	}
+
+	bus, err := newBackplane(os.Getenv("WS_BACKPLANE"))
+	if err != nil {
+		return err
+	}
+	hub.UseBackplane(bus)
+
+	if err := startQueue(); err != nil {
+		return err
+	}
+
+	go presence.run()
+	return nil
+}
+
+type presenceTracker struct {
+	mu     sync.Mutex
+	users  map[string]string
+	agents map[string]string
+}
+
+var presence = &presenceTracker{
+	users:  make(map[string]string),
+	agents: make(map[string]string),
+}
+
+const (
+	kindUser  = "user"
+	kindAgent = "agent"
+)
+
+// presenceColl holds what each instance sees of each principal, one document
+// per instance and principal. An instance refreshes its documents on every
+// heartbeat tick, so those of an instance that died go stale and are swept.
+func presenceColl() *mongo.Collection {
+	return utils.MongoDB.Collection("presence")
+}
+
+func presenceStaleAfter() time.Duration {
+	return 3 * heartbeat.pingInterval
+}
+
+// run demotes principals whose connections are alive but idle to away and
+// promotes them back to online as soon as they show activity again.
+func (p *presenceTracker) run() {
+	ticker := time.NewTicker(heartbeat.pingInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		snapshot := hub.Activity()
+		now := time.Now()
+
+		for userID, last := range snapshot.users {
+			p.setUser(userID, stateFor(now, last))
+		}
+		for agentID, last := range snapshot.agents {
+			p.setAgent(agentID, stateFor(now, last))
+		}
+
+		for _, userID := range p.missing(p.users, snapshot.users) {
+			p.setUser(userID, PresenceOffline)
+		}
+		for _, agentID := range p.missing(p.agents, snapshot.agents) {
+			p.setAgent(agentID, PresenceOffline)
+		}
+
+		p.refresh(now)
+	}
+}
+
+// refresh keeps this instance's presence documents fresh and sweeps those
+// other instances stopped refreshing, re-evaluating whoever they were for.
+func (p *presenceTracker) refresh(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	coll := presenceColl()
+	if _, err := coll.UpdateMany(ctx, bson.M{"instance": hub.id}, bson.M{"$set": bson.M{"at": now}}); err != nil {
+		log.Printf("[PRESENCE][ERROR] Failed to refresh presence: %v", err)
+		return
+	}
+
+	cursor, err := coll.Find(ctx, bson.M{"at": bson.M{"$lt": now.Add(-presenceStaleAfter())}})
+	if err != nil {
+		return
+	}
+	var stale []struct {
+		ID   string    `bson:"_id"`
+		Kind string    `bson:"kind"`
+		Who  string    `bson:"who"`
+		At   time.Time `bson:"at"`
+	}
+	if err := cursor.All(ctx, &stale); err != nil {
+		return
+	}
+	for _, doc := range stale {
+		res, err := coll.DeleteOne(ctx, bson.M{"_id": doc.ID, "at": doc.At})
+		if err != nil || res.DeletedCount == 0 {
+			continue
+		}
+		log.Printf("[PRESENCE] Swept stale presence of %s %s", doc.Kind, doc.Who)
+		if doc.Kind == kindAgent {
+			p.applyAgent(doc.Who)
+		} else {
+			p.applyUser(doc.Who)
+		}
+	}
+}
+
+func (p *presenceTracker) missing(tracked map[string]string, connected map[string]time.Time) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var ids []string
+	for id := range tracked {
+		if _, ok := connected[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func stateFor(now, lastActive time.Time) string {
+	if now.Sub(lastActive) >= heartbeat.awayAfter {
+		return PresenceAway
+	}
+	return PresenceOnline
+}
+
+// record stores this instance's view of a principal.
+func record(ctx context.Context, kind, id, state string) error {
+	key := hub.id + ":" + kind + ":" + id
+	if state == PresenceOffline {
+		_, err := presenceColl().DeleteOne(ctx, bson.M{"_id": key})
+		return err
+	}
+	_, err := presenceColl().UpdateOne(ctx,
+		bson.M{"_id": key},
+		bson.M{"$set": bson.M{"instance": hub.id, "kind": kind, "who": id, "state": state, "at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// combined is a principal's presence across all instances: online if any
+// instance sees them online, away if any sees them at all, else offline.
+func combined(ctx context.Context, kind, id string) (string, error) {
+	cursor, err := presenceColl().Find(ctx, bson.M{
+		"kind": kind,
+		"who":  id,
+		"at":   bson.M{"$gte": time.Now().Add(-presenceStaleAfter())},
+	})
+	if err != nil {
+		return "", err
+	}
+	var docs []struct {
+		State string `bson:"state"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return "", err
+	}
+	state := PresenceOffline
+	for _, d := range docs {
+		if d.State == PresenceOnline {
+			return PresenceOnline, nil
+		}
+		state = PresenceAway
+	}
+	return state, nil
+}
+
+func (p *presenceTracker) setUser(userID, state string) {
+	if !p.transition(p.users, userID, state) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := record(ctx, kindUser, userID, state); err != nil {
+		log.Printf("[PRESENCE][ERROR] Failed to record user %s: %v", userID, err)
+		return
+	}
+	p.applyUser(userID)
+}
+
+func (p *presenceTracker) applyUser(userID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	state, err := combined(ctx, kindUser, userID)
+	if err != nil {
+		log.Printf("[PRESENCE][ERROR] Failed to read presence of user %s: %v", userID, err)
+		return
+	}
+	_, err = utils.MongoDB.Collection("users").UpdateOne(ctx,
+		bson.M{"email": userID},
+		bson.M{"$set": bson.M{"presence": state, "lastSeen": time.Now()}},
+	)
+	if err != nil {
+		log.Printf("[PRESENCE][ERROR] Failed to update user %s: %v", userID, err)
+	}
+}
+
+func (p *presenceTracker) setAgent(agentID, state string) {
+	if !p.transition(p.agents, agentID, state) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := record(ctx, kindAgent, agentID, state); err != nil {
+		log.Printf("[PRESENCE][ERROR] Failed to record agent %s: %v", agentID, err)
+		return
+	}
+	p.applyAgent(agentID)
+}
+
+// applyAgent writes an agent's combined presence, so one instance losing
+// a connection does not take offline an agent still connected to another.
+func (p *presenceTracker) applyAgent(agentID string) {
+	agentObjId, err := primitive.ObjectIDFromHex(agentID)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	state, err := combined(ctx, kindAgent, agentID)
+	if err != nil {
+		log.Printf("[PRESENCE][ERROR] Failed to read presence of agent %s: %v", agentID, err)
+		return
+	}
+	res, err := utils.AgentColl.UpdateOne(ctx,
+		bson.M{"_id": agentObjId, "presence": bson.M{"$ne": state}},
+		bson.M{"$set": bson.M{"presence": state, "lastSeen": time.Now()}},
+	)
+	if err != nil {
+		log.Printf("[PRESENCE][ERROR] Failed to update agent %s: %v", agentID, err)
+		return
+	}
+	if res.ModifiedCount == 0 {
+		return
+	}
+	// Availability follows presence, but a busy agent stays busy until their
+	// sessions end, whatever their connection is doing; releasing the last
+	// one then applies the recorded presence. Coming back online makes an
+	// agent available or busy depending on their load.
+	switch state {
+	case PresenceOnline:
+		if changed, err := utils.MarkAgentWorking(ctx, agentObjId, "", "offline", "away"); err == nil && changed {
+			RequestDispatch()
+		}
+	case PresenceAway:
+		utils.AgentColl.UpdateOne(ctx,
+			bson.M{"_id": agentObjId, "status": "available"},
+			bson.M{"$set": bson.M{"status": "away"}},
+		)
+	case PresenceOffline:
+		utils.AgentColl.UpdateOne(ctx,
+			bson.M{"_id": agentObjId, "status": bson.M{"$ne": "busy"}},
+			bson.M{"$set": bson.M{"status": "offline"}},
+		)
+	}
+
+	log.Printf("[PRESENCE] Agent %s is now %s", agentID, state)
+}
+
+func (p *presenceTracker) transition(m map[string]string, id, state string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if m[id] == state {
+		return false
+	}
+	if state == PresenceOffline {
+		delete(m, id)
+	} else {
+		m[id] = state
+	}
+	return true
+}
@@ -0,0 +1,163 @@
+package websocket
+
+import (
+	"encoding/json"
+	"time"
+
+	"backend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ProtocolVersion is bumped whenever a frame's shape changes incompatibly.
+const ProtocolVersion = 1
+
+const maxMessageLength = 4000
+
+// Frame types. Clients may only send TypeChatMessage; everything else is
+// server to client.
+const (
+	TypeChatMessage   = "chat_message"
+	TypeHistory       = "history"
+	TypeSessionState  = "session_state"
+	TypeNewSession    = "new_session"
+	TypeSessionUpdate = "session_update"
+	TypeSessionEnd    = "session_end"
+	TypeAIDelta       = "ai_delta"
+	TypeAIComplete    = "ai_complete"
+	TypeAICancelled   = "ai_cancelled"
+	TypeQueueStatus   = "queue_status"
+	TypeError         = "error"
+)
+
+const (
+	ErrCodeBadFrame           = "bad_frame"
+	ErrCodeUnsupportedVersion = "unsupported_version"
+	ErrCodeUnknownType        = "unknown_type"
+	ErrCodeInvalidPayload     = "invalid_payload"
+	ErrCodeSessionNotFound    = "session_not_found"
+	ErrCodeForbidden          = "forbidden"
+	ErrCodeSessionClosed      = "session_closed"
+	ErrCodeInternal           = "internal_error"
+)
+
+type Envelope struct {
+	Type      string          `json:"type"`
+	Version   int             `json:"version"`
+	ID        string          `json:"id,omitempty"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+// Frame.Seq is set on frames that carry a stored message. It increases
+// monotonically within a session, so clients can resume from the last one
+// they saw and drop duplicates.
+type Frame struct {
+	Type      string      `json:"type"`
+	Version   int         `json:"version"`
+	ID        string      `json:"id"`
+	SessionID string      `json:"sessionId,omitempty"`
+	Seq       int64       `json:"seq,omitempty"`
+	Payload   interface{} `json:"payload,omitempty"`
+}
+
+type ChatMessageIn struct {
+	Text string `json:"text"`
+}
+
+// ChatMessageOut.Citations lists the knowledge base articles an AI reply was
+// grounded in.
+type ChatMessageOut struct {
+	Sender    string    `json:"sender"`
+	Text      string    `json:"text"`
+	Timestamp time.Time `json:"timestamp"`
+	Citations []string  `json:"citations,omitempty"`
+}
+
+type AIDelta struct {
+	Text string `json:"text"`
+}
+
+type SessionState struct {
+	Mode          string `json:"mode,omitempty"`
+	Status        string `json:"status"`
+	AssignedAgent string `json:"assignedAgent,omitempty"`
+}
+
+// QueueStatus is sent to a customer waiting for an agent.
+type QueueStatus struct {
+	Position             int `json:"position"`
+	EstimatedWaitSeconds int `json:"estimatedWaitSeconds"`
+}
+
+type SessionEvent struct {
+	SessionID     string    `json:"sessionId"`
+	UserID        string    `json:"userId,omitempty"`
+	AssignedAgent string    `json:"assignedAgent,omitempty"`
+	PreviousAgent string    `json:"previousAgent,omitempty"`
+	Mode          string    `json:"mode,omitempty"`
+	Status        string    `json:"status,omitempty"`
+	LastActivity  time.Time `json:"lastActivity,omitempty"`
+	Action        string    `json:"action,omitempty"`
+}
+
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func newFrame(frameType, sessionID string, payload interface{}) Frame {
+	return Frame{
+		Type:      frameType,
+		Version:   ProtocolVersion,
+		ID:        primitive.NewObjectID().Hex(),
+		SessionID: sessionID,
+		Payload:   payload,
+	}
+}
+
+func messageFrame(frameType string, msg models.Message) Frame {
+	f := newFrame(frameType, msg.SessionID.Hex(), ChatMessageOut{
+		Sender:    msg.Sender,
+		Text:      msg.Text,
+		Timestamp: msg.Timestamp,
+		Citations: msg.Citations,
+	})
+	if !msg.ID.IsZero() {
+		f.ID = msg.ID.Hex()
+	}
+	f.Seq = msg.Seq
+	return f
+}
+
+// errorFrame reuses the offending frame's id so the client can correlate it.
+func errorFrame(replyTo, sessionID, code, message string) Frame {
+	f := newFrame(TypeError, sessionID, ErrorPayload{Code: code, Message: message})
+	if replyTo != "" {
+		f.ID = replyTo
+	}
+	return f
+}
+
+// aiDeltaFrame carries the id the reply will be stored under, so the client
+// can match every delta, and the final ai_complete frame, to one bubble.
+func aiDeltaFrame(replyID primitive.ObjectID, sessionID, text string) Frame {
+	f := newFrame(TypeAIDelta, sessionID, AIDelta{Text: text})
+	f.ID = replyID.Hex()
+	return f
+}
+
+func sessionStateFrame(sessionID, mode, status, assignedAgent string) Frame {
+	return newFrame(TypeSessionState, sessionID, SessionState{
+		Mode:          mode,
+		Status:        status,
+		AssignedAgent: assignedAgent,
+	})
+}
+
+func queueStatusFrame(sessionID string, position int, wait time.Duration) Frame {
+	return newFrame(TypeQueueStatus, sessionID, QueueStatus{
+		Position:             position,
+		EstimatedWaitSeconds: int(wait.Seconds()),
+	})
+}
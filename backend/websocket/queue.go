@@ -0,0 +1,197 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+)
+
+type queueDispatcher struct {
+	router        utils.Router
+	kick          chan struct{}
+	interval      time.Duration
+	handleTime    time.Duration
+	fallbackAfter time.Duration
+}
+
+var dispatcher = &queueDispatcher{
+	kick:          make(chan struct{}, 1),
+	interval:      15 * time.Second,
+	handleTime:    5 * time.Minute,
+	fallbackAfter: 2 * time.Minute,
+}
+
+func startQueue() error {
+	router, err := utils.NewRouter(os.Getenv("QUEUE_STRATEGY"))
+	if err != nil {
+		return err
+	}
+	dispatcher.router = router
+	dispatcher.interval = utils.DurationEnv("QUEUE_DISPATCH_INTERVAL", dispatcher.interval)
+	dispatcher.handleTime = utils.DurationEnv("QUEUE_AVG_HANDLE_TIME", dispatcher.handleTime)
+	dispatcher.fallbackAfter = utils.DurationEnv("ROUTING_FALLBACK_AFTER", dispatcher.fallbackAfter)
+
+	// Loads are recounted once so routing starts from the sessions that are
+	// really open, whatever happened while no instance was running.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := utils.ReconcileAgentLoads(ctx); err != nil {
+		log.Printf("[QUEUE][ERROR] Failed to recount agent loads: %v", err)
+	}
+
+	log.Printf("[QUEUE] Routing strategy: %s", router.Name())
+	go dispatcher.run()
+	return nil
+}
+
+// RequestDispatch asks for an assignment pass as soon as possible, e.g.
+// because a session was queued or an agent became available. Requests made
+// while a pass is pending are folded into it.
+func RequestDispatch() {
+	select {
+	case dispatcher.kick <- struct{}{}:
+	default:
+	}
+}
+
+// run also dispatches on a timer, which picks up agents freed on other
+// instances and keeps the customers' estimated waits fresh.
+func (d *queueDispatcher) run() {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.kick:
+		case <-ticker.C:
+		}
+		d.dispatch()
+	}
+}
+
+// dispatch walks the queue oldest first and hands each session to the best
+// ranked agent that can still be claimed. Agent and session are both claimed
+// with conditional updates, so instances dispatching at the same time, or an
+// agent taking a session by hand, never end up sharing a session.
+func (d *queueDispatcher) dispatch() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sessions, err := utils.QueuedSessions(ctx)
+	if err != nil {
+		log.Printf("[QUEUE][ERROR] Failed to load queue: %v", err)
+		return
+	}
+	if len(sessions) == 0 {
+		return
+	}
+
+	var waiting []models.Session
+	for _, s := range sessions {
+		agents, err := utils.AvailableAgents(ctx)
+		if err != nil {
+			log.Printf("[QUEUE][ERROR] Failed to load agents: %v", err)
+			return
+		}
+		if len(agents) == 0 {
+			waiting = append(waiting, s)
+			continue
+		}
+
+		assigned, stillQueued := d.assign(ctx, s, agents)
+		if !assigned && stillQueued {
+			waiting = append(waiting, s)
+		}
+	}
+
+	d.announcePositions(ctx, waiting)
+}
+
+// assign reports whether the session was given to an agent and, if not,
+// whether it is still in the queue. Until the session has waited
+// fallbackAfter only agents with its skill and language are considered;
+// after that anyone will do, closest match first.
+func (d *queueDispatcher) assign(ctx context.Context, s models.Session, agents []models.Agent) (bool, bool) {
+	fallback := time.Since(s.QueuedAt) >= d.fallbackAfter
+	for _, agent := range utils.PreferMatching(d.router.Rank(ctx, agents), s, fallback) {
+		ok, err := utils.ClaimAgent(ctx, agent.ID)
+		if err != nil {
+			log.Printf("[QUEUE][ERROR] Failed to claim agent %s: %v", agent.ID.Hex(), err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		agentID := agent.ID.Hex()
+		session, ok, err := utils.ClaimSession(ctx, s.ID, agentID, utils.ActorSystem, "dispatch", utils.StateQueued)
+		if err != nil || !ok {
+			utils.ReleaseAgent(ctx, agent.ID)
+			if err != nil {
+				log.Printf("[QUEUE][ERROR] Failed to claim session %s: %v", s.ID.Hex(), err)
+				return false, true
+			}
+			return false, false
+		}
+
+		d.router.Assigned(agentID)
+		log.Printf("[QUEUE] Session %s assigned to agent %s after %s", session.ID.Hex(), agentID,
+			time.Since(s.QueuedAt).Round(time.Second))
+		AnnounceAssignment(session, agentID, "assigned")
+		return true, false
+	}
+	return false, true
+}
+
+// announcePositions tells every waiting customer where they are in the queue
+// and roughly how long it will take, assuming each working agent frees up
+// once per average handle time.
+func (d *queueDispatcher) announcePositions(ctx context.Context, waiting []models.Session) {
+	if len(waiting) == 0 {
+		return
+	}
+	agents := utils.OnlineAgentCount(ctx)
+	if agents == 0 {
+		agents = 1
+	}
+
+	for i, s := range waiting {
+		position := i + 1
+		rounds := (position + agents - 1) / agents
+		wait := time.Duration(rounds) * d.handleTime
+		SendToUser(s.UserID, queueStatusFrame(s.ID.Hex(), position, wait))
+	}
+}
+
+// AnnounceAssignment tells the customer, the agents and the new owner that a
+// session has been handed to agentID, and stops any AI reply still in flight.
+// It returns the history it sent to the agent.
+func AnnounceAssignment(session models.Session, agentID, action string) []models.Message {
+	sessionID := session.ID.Hex()
+	CancelAIReply(sessionID)
+
+	NotifySessionState(session.UserID, sessionID, "human", "active", agentID)
+	BroadcastSessionUpdate(SessionEvent{
+		SessionID:     sessionID,
+		UserID:        session.UserID,
+		AssignedAgent: agentID,
+		Mode:          "human",
+		Status:        "active",
+		LastActivity:  session.LastActivity,
+		Action:        action,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	messages, err := utils.FindSessionMessages(ctx, session.ID, 0)
+	if err != nil {
+		log.Printf("[QUEUE][ERROR] Failed to load history for session %s: %v", sessionID, err)
+		return nil
+	}
+	SendHistory(agentID, messages)
+	return messages
+}
@@ -0,0 +1,51 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"backend/models"
+	"backend/utils"
+)
+
+// tagSession lets the model fill in the skill and language of a session
+// the customer started without choosing them. Only the first few customer
+// messages are considered; after that the session keeps whatever it has.
+func tagSession(session models.Session) {
+	if session.RequiredSkill != "" && session.Language != "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	messages, err := utils.FindSessionMessages(ctx, session.ID, 0)
+	if err != nil {
+		return
+	}
+	var texts []string
+	for _, m := range messages {
+		if m.Sender == "user" {
+			texts = append(texts, m.Text)
+		}
+	}
+	if len(texts) == 0 || len(texts) > utils.RoutingDetectMessages() {
+		return
+	}
+
+	skill, lang, err := utils.DetectRouting(ctx, strings.Join(texts, "\n"))
+	if err != nil {
+		log.Printf("[ROUTING][ERROR] Failed to detect routing for session %s: %v", session.ID.Hex(), err)
+		return
+	}
+	if skill == "" && lang == "" {
+		return
+	}
+	if err := utils.TagSession(ctx, session.ID, skill, lang); err != nil {
+		log.Printf("[ROUTING][ERROR] Failed to tag session %s: %v", session.ID.Hex(), err)
+		return
+	}
+	log.Printf("[ROUTING] Session %s tagged skill=%q language=%q", session.ID.Hex(), skill, lang)
+}
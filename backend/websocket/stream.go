@@ -0,0 +1,113 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// aiReplyTracker remembers the AI replies being streamed for each session so
+// an agent taking over can stop them.
+type aiReplyTracker struct {
+	mu      sync.Mutex
+	running map[string]map[*context.CancelFunc]struct{}
+}
+
+var aiReplies = &aiReplyTracker{
+	running: make(map[string]map[*context.CancelFunc]struct{}),
+}
+
+func (t *aiReplyTracker) start(sessionID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	t.mu.Lock()
+	if t.running[sessionID] == nil {
+		t.running[sessionID] = make(map[*context.CancelFunc]struct{})
+	}
+	t.running[sessionID][&cancel] = struct{}{}
+	t.mu.Unlock()
+
+	return ctx, func() {
+		t.mu.Lock()
+		delete(t.running[sessionID], &cancel)
+		if len(t.running[sessionID]) == 0 {
+			delete(t.running, sessionID)
+		}
+		t.mu.Unlock()
+		cancel()
+	}
+}
+
+func (t *aiReplyTracker) cancel(sessionID string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	count := 0
+	for cancel := range t.running[sessionID] {
+		(*cancel)()
+		count++
+	}
+	return count
+}
+
+// CancelAIReply stops any AI reply still streaming for the session, on this
+// instance or, through the backplane, on any other.
+func CancelAIReply(sessionID string) {
+	hub.publish(BusMessage{CancelAIReply: sessionID})
+	aiReplies.cancel(sessionID)
+}
+
+// deltaRelayInterval is how often deltas for a customer connected to another
+// instance are relayed over the backplane, as one frame each time.
+const deltaRelayInterval = 250 * time.Millisecond
+
+// deltaStream sends the deltas of one AI reply to the customer. Deltas go
+// straight to a connection on this instance; only without one are they
+// batched and relayed, so a reply does not cost a backplane event per token.
+// A customer with connections on several instances sees the deltas on the
+// local ones only; the ai_complete frame carries the full reply to all.
+type deltaStream struct {
+	userID    string
+	sessionID string
+	replyID   primitive.ObjectID
+	pending   strings.Builder
+	relayed   time.Time
+}
+
+func newDeltaStream(userID, sessionID string, replyID primitive.ObjectID) *deltaStream {
+	return &deltaStream{userID: userID, sessionID: sessionID, replyID: replyID, relayed: time.Now()}
+}
+
+func (s *deltaStream) send(delta string) {
+	s.pending.WriteString(delta)
+	data, err := json.Marshal(aiDeltaFrame(s.replyID, s.sessionID, s.pending.String()))
+	if err != nil {
+		return
+	}
+	if hub.sendLocalToUser(s.userID, data) {
+		s.pending.Reset()
+		return
+	}
+	if time.Since(s.relayed) >= deltaRelayInterval {
+		s.flush()
+	}
+}
+
+// flush relays whatever is still pending; call it before the frame that
+// ends the reply.
+func (s *deltaStream) flush() {
+	if s.pending.Len() == 0 {
+		return
+	}
+	data, err := json.Marshal(aiDeltaFrame(s.replyID, s.sessionID, s.pending.String()))
+	if err != nil {
+		return
+	}
+	hub.publish(BusMessage{UserID: s.userID, Data: data})
+	s.pending.Reset()
+	s.relayed = time.Now()
+}
@@ -0,0 +1,101 @@
+const API_BASE = 'http://localhost:8080';
+
+export function saveTokens(data) {
+  localStorage.setItem('accessToken', data.accessToken);
+  localStorage.setItem('refreshToken', data.refreshToken);
+}
+
+export function getAccessToken() {
+  return typeof window === 'undefined' ? null : localStorage.getItem('accessToken');
+}
+
+async function refreshTokens() {
+  const refreshToken = localStorage.getItem('refreshToken');
+  if (!refreshToken) return false;
+  const res = await fetch(`${API_BASE}/api/auth/refresh`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ refreshToken }),
+  });
+  if (!res.ok) return false;
+  saveTokens(await res.json());
+  return true;
+}
+
+export async function authFetch(url, options = {}) {
+  const withAuth = () => ({
+    ...options,
+    headers: { ...(options.headers || {}), Authorization: `Bearer ${getAccessToken()}` },
+  });
+  let res = await fetch(url, withAuth());
+  if (res.status === 401 && (await refreshTokens())) {
+    res = await fetch(url, withAuth());
+  }
+  return res;
+}
+
+export const PROTOCOL_VERSION = 1;
+
+export function chatFrame(sessionId, text) {
+  return JSON.stringify({
+    type: 'chat_message',
+    version: PROTOCOL_VERSION,
+    id: `${Date.now()}-${Math.random().toString(36).slice(2)}`,
+    sessionId,
+    payload: { text },
+  });
+}
+
+export function wsUrl(query = '') {
+  const params = new URLSearchParams(query);
+  params.set('token', getAccessToken() || '');
+  return `ws://localhost:8080/ws?${params.toString()}`;
+}
+
+// openChatSocket keeps a session socket alive across network drops. It
+// remembers the highest message seq it has delivered, reconnects with it so
+// the server replays anything missed, and drops frames it has already seen.
+export function openChatSocket(sessionId, { onFrame, onOpen, onClose } = {}) {
+  let socket = null;
+  let lastSeq = 0;
+  let attempt = 0;
+  let stopped = false;
+  let timer = null;
+
+  const connect = () => {
+    socket = new window.WebSocket(wsUrl({ sessionId, lastSeq }));
+    socket.onopen = () => {
+      attempt = 0;
+      onOpen && onOpen();
+    };
+    socket.onmessage = (event) => {
+      const frame = JSON.parse(event.data);
+      if (frame.seq) {
+        if (frame.seq <= lastSeq) return;
+        lastSeq = frame.seq;
+      }
+      onFrame && onFrame(frame);
+    };
+    socket.onclose = () => {
+      onClose && onClose();
+      if (stopped) return;
+      const delay = Math.min(30000, 1000 * 2 ** attempt);
+      attempt += 1;
+      timer = setTimeout(connect, delay);
+    };
+  };
+  connect();
+
+  return {
+    send: (text) => {
+      if (!socket || socket.readyState !== 1) return false;
+      socket.send(chatFrame(sessionId, text));
+      return true;
+    },
+    close: () => {
+      stopped = true;
+      clearTimeout(timer);
+      socket && socket.close();
+    },
+  };
+}
@@ -1,6 +1,7 @@
 import { useEffect, useRef, useState } from 'react';
 import useChatWebSocket from '../../useChatWebSocket';
 import { Inter } from "next/font/google";
+import { authFetch } from '../../auth';
 
 const inter = Inter({
   variable: "--font-inter",
@@ -43,8 +44,10 @@ export default function AgentChat() {
           if (data.sessionId === sessionIdFromUrl && Date.now() - data.timestamp < 300000) {
     
             const formattedMessages = data.messages.map(msg => ({
+              seq: msg.seq,
               sender: msg.sender,
               text: msg.text,
+              citations: msg.citations,
               timestamp: msg.timestamp
             }));
             setInitialMessages(formattedMessages);
@@ -62,7 +65,7 @@ export default function AgentChat() {
         fetchSessionMessages(sessionIdFromUrl);
       }
     } else if (agentId) {
-      fetch(`http://localhost:8080/api/agent/active-sessions/${agentId}`)
+      authFetch(`http://localhost:8080/api/agent/active-sessions/${agentId}`)
         .then(res => res.json())
         .then(data => {
           if (data.sessions && data.sessions.length > 0) {
@@ -83,7 +86,7 @@ export default function AgentChat() {
 
   useEffect(() => {
     if (currentSession && currentSession.userId) {
-      fetch(`http://localhost:8080/api/user/${currentSession.userId}`)
+      authFetch(`http://localhost:8080/api/user/${currentSession.userId}`)
         .then(res => res.json())
         .then(data => {
           setUserInfo(data);
@@ -98,7 +101,7 @@ export default function AgentChat() {
     if (!sessionId) return;
     
     try {
-      const response = await fetch(`http://localhost:8080/api/session/messages?sessionId=${sessionId}`);
+      const response = await authFetch(`http://localhost:8080/api/session/messages?sessionId=${sessionId}`);
       
       if (response.ok) {
         const data = await response.json();
@@ -106,8 +109,10 @@ export default function AgentChat() {
         
         const messagesArray = Array.isArray(data) ? data : (data.messages || []);
         const formattedMessages = messagesArray.map(msg => ({
+          seq: msg.seq,
           sender: msg.sender,
           text: msg.text,
+          citations: msg.citations,
           timestamp: msg.timestamp || new Date().toISOString()
         }));
         
@@ -194,7 +199,7 @@ export default function AgentChat() {
     if (!sessionId) return;
     
     try {
-      const response = await fetch('http://localhost:8080/api/session/end', {
+      const response = await authFetch('http://localhost:8080/api/session/end', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
@@ -299,6 +304,9 @@ export default function AgentChat() {
                     : 'bg-muted text-muted-foreground'
                 }`}>
                   <div className="text-sm">{message.text}</div>
+                  {message.citations && message.citations.length > 0 && (
+                    <div className="text-xs opacity-70 mt-1">📚 Kaynaklar: {message.citations.join(', ')}</div>
+                  )}
                 </div>
               </div>
             </div>
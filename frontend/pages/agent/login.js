@@ -1,5 +1,6 @@
 import { useState } from 'react';
 import { Inter } from "next/font/google";
+import { saveTokens } from '../../auth';
 
 const inter = Inter({
   variable: "--font-inter",
@@ -26,6 +27,7 @@ export default function AgentLogin() {
       if (res.ok) {
         const agentId = data.agentId;
         localStorage.setItem('agentId', agentId);
+        saveTokens(data);
         window.location.href = '/agent/sessions';
       } else {
         alert(data.error || 'Giriş bilgileri hatalı.');
@@ -84,10 +86,7 @@ export default function AgentLogin() {
         
         <div className="card-footer justify-center">
           <p className="text-sm text-muted-foreground">
-            Hesabınız yok mu?{' '}
-            <a href="/agent/register" className="text-primary hover:underline">
-              Kayıt olun
-            </a>
+            Hesabınız yok mu? Yöneticinizden bir hesap isteyin.
           </p>
         </div>
       </div>
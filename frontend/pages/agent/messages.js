@@ -1,5 +1,6 @@
 import { useEffect, useState } from 'react';
 import { Inter } from "next/font/google";
+import { authFetch } from '../../auth';
 
 const inter = Inter({
   variable: "--font-inter",
@@ -24,7 +25,7 @@ export default function AgentMessages() {
 
   const fetchSessions = async (agentId) => {
     try {
-      const response = await fetch(`http://localhost:8080/api/session/agent/${agentId}`);
+      const response = await authFetch(`http://localhost:8080/api/session/agent/${agentId}`);
       const data = await response.json();
       
       if (response.ok) {
@@ -41,7 +42,7 @@ export default function AgentMessages() {
 
   const fetchMessages = async (sessionId) => {
     try {
-      const response = await fetch(`http://localhost:8080/api/session/messages?sessionId=${sessionId}`);
+      const response = await authFetch(`http://localhost:8080/api/session/messages?sessionId=${sessionId}`);
       
       if (response.ok) {
         const data = await response.json();
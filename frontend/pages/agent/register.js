@@ -1,5 +1,6 @@
 import { useState } from 'react';
 import { Inter } from "next/font/google";
+import { authFetch } from '../../auth';
 
 const inter = Inter({
   variable: "--font-inter",
@@ -24,7 +25,9 @@ export default function AgentRegister() {
     setLoading(true);
 
     try {
-      const res = await fetch('http://localhost:8080/api/agent/register', {
+      // Only admins may create staff accounts, so this goes out with the
+      // admin's own token.
+      const res = await authFetch('http://localhost:8080/api/agent/register', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json'
@@ -32,12 +35,13 @@ export default function AgentRegister() {
         body: JSON.stringify(form)
       });
 
-      const data = await res.json();
       if (res.ok) {
-        alert('Kayıt başarılı! Giriş sayfasına yönlendiriliyorsunuz.');
-        window.location.href = '/agent/login';
+        alert('Agent hesabı oluşturuldu.');
+        setForm({ name: '', email: '', password: '' });
+      } else if (res.status === 401 || res.status === 403) {
+        alert('Agent hesabı yalnızca yöneticiler tarafından oluşturulabilir.');
       } else {
-        alert(data.error || 'Bir hata oluştu.');
+        alert((await res.text()) || 'Bir hata oluştu.');
       }
 
     } catch (err) {
@@ -54,7 +58,7 @@ export default function AgentRegister() {
         <div className="card-header text-center">
           <h1 className="card-title">Agent Kayıt</h1>
           <p className="card-description">
-            Müşteri temsilcisi hesabı oluşturun
+            Yönetici olarak yeni bir müşteri temsilcisi hesabı oluşturun
           </p>
         </div>
         
@@ -74,7 +78,7 @@ export default function AgentRegister() {
             <input
               name="email"
               type="email"
-              placeholder="E-posta adresiniz"
+              placeholder="E-posta adresi"
               value={form.email}
               onChange={handleChange}
               required
@@ -86,7 +90,7 @@ export default function AgentRegister() {
             <input
               name="password"
               type="password"
-              placeholder="Şifreniz"
+              placeholder="Geçici şifre"
               value={form.password}
               onChange={handleChange}
               required
@@ -99,15 +103,14 @@ export default function AgentRegister() {
             disabled={loading} 
             className="btn btn-primary btn-md w-full"
           >
-            {loading ? 'Kaydediliyor...' : 'Kayıt Ol'}
+            {loading ? 'Kaydediliyor...' : 'Hesap Oluştur'}
           </button>
         </form>
         
         <div className="card-footer justify-center">
           <p className="text-sm text-muted-foreground">
-            Zaten hesabınız var mı?{' '}
-            <a href="/agent/login" className="text-primary hover:underline">
-              Giriş yapın
+            <a href="/agent/sessions" className="text-primary hover:underline">
+              Panele dön
             </a>
           </p>
         </div>
@@ -1,5 +1,6 @@
 import { useEffect, useState, useRef } from 'react';
 import { Inter } from "next/font/google";
+import { authFetch, wsUrl } from '../../auth';
 
 const inter = Inter({
   variable: "--font-inter",
@@ -18,7 +19,7 @@ export default function AgentSessions() {
 
   const fetchActiveSessions = (agentId) => {
     console.log('Fetching active sessions for agent:', agentId);
-    fetch(`http://localhost:8080/api/agent/active-sessions/${agentId}`)
+    authFetch(`http://localhost:8080/api/agent/active-sessions/${agentId}`)
       .then(res => {
         console.log('Active sessions response status:', res.status);
         return res.json();
@@ -42,7 +43,7 @@ export default function AgentSessions() {
 
   const fetchSystemSessions = () => {
     console.log('Fetching AI sessions');
-    fetch('http://localhost:8080/api/sessions/ai')
+    authFetch('http://localhost:8080/api/sessions/ai')
       .then(res => {
         console.log('AI sessions response status:', res.status);
         return res.json();
@@ -68,8 +69,7 @@ export default function AgentSessions() {
       fetchSystemSessions();
 
   
-      const wsUrl = `ws://localhost:8080/ws?agentId=${agentId}`;
-      ws.current = new WebSocket(wsUrl);
+      ws.current = new WebSocket(wsUrl());
       
       ws.current.onopen = () => {
         setConnected(true);
@@ -105,12 +105,20 @@ export default function AgentSessions() {
           else if (data.type === 'session_update') {
   
             const updatedSession = data.payload;
-            if (updatedSession.action === 'takeover') {
+            if (updatedSession.action === 'takeover' || updatedSession.action === 'assigned') {
     
               setSystemSessions(prev => prev.filter(s => s.sessionId !== updatedSession.sessionId));
     
               if (updatedSession.assignedAgent === agentId) {
                 setActiveSessions(prev => [...prev, updatedSession]);
+                if (updatedSession.action === 'assigned') {
+                  setNotifications(prev => [...prev, {
+                    id: Date.now(),
+                    type: 'new_session',
+                    message: '📥 Kuyruktan size yeni bir müşteri atandı',
+                    timestamp: Date.now()
+                  }]);
+                }
               }
             }
             setDebug(d => d + '\n[WS] Session updated: ' + updatedSession.sessionId);
@@ -156,9 +164,20 @@ export default function AgentSessions() {
     return () => clearTimeout(timer);
   }, [notifications]);
 
+  const handleSessionConflict = (data) => {
+    setSystemSessions(prev => prev.filter(s => s.sessionId !== data.sessionId));
+    setNotifications(prev => [...prev, {
+      id: Date.now(),
+      type: 'session_end',
+      message: '⚠️ Bu session başka bir temsilci tarafından alındı',
+      timestamp: Date.now()
+    }]);
+    setDebug(d => d + '\nsession ' + data.sessionId + ' already taken by ' + data.assignedAgent);
+  };
+
   const handleTakeOverSystemSession = async (sessionId) => {
     try {
-      const response = await fetch('http://localhost:8080/api/agent/takeover', {
+      const response = await authFetch('http://localhost:8080/api/agent/takeover', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
@@ -183,6 +202,8 @@ export default function AgentSessions() {
         }));
         
         window.location.href = `/agent/chat?sessionId=${data.sessionId}`;
+      } else if (response.status === 409) {
+        handleSessionConflict(data);
       } else {
         setDebug(d => d + '\nno system sessions available');
       }
@@ -193,7 +214,7 @@ export default function AgentSessions() {
 
   const handleSetAvailability = async (available) => {
     try {
-      const response = await fetch('http://localhost:8080/api/agent/status', {
+      const response = await authFetch('http://localhost:8080/api/agent/status', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
@@ -215,7 +236,7 @@ export default function AgentSessions() {
 
   const handleTakeSession = async (session) => {
     try {
-      const response = await fetch('http://localhost:8080/api/agent/assign-session', {
+      const response = await authFetch('http://localhost:8080/api/agent/assign-session', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
@@ -239,6 +260,8 @@ export default function AgentSessions() {
         }));
         
         window.location.href = `/agent/chat?sessionId=${data.sessionId}`;
+      } else if (response.status === 409) {
+        handleSessionConflict(data);
       } else {
         setDebug(d => d + '\nfailed to assign session: ' + data.message);
       }
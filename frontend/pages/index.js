@@ -69,12 +69,6 @@ export default function Home() {
                 >
                   Agent Girişi
                 </a>
-                <a 
-                  href="/agent/register" 
-                  className="border border-blue-600 text-blue-400 hover:bg-blue-600 hover:text-white px-4 py-2 rounded-md"
-                >
-                  Agent Kayıt
-                </a>
               </div>
             </div>
           </div>
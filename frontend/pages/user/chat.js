@@ -1,6 +1,7 @@
 import { useEffect, useRef, useState } from 'react';
 import useChatWebSocket from '../../useChatWebSocket';
 import { Inter } from "next/font/google";
+import { authFetch, openChatSocket } from '../../auth';
 
 const inter = Inter({
   variable: "--font-inter",
@@ -13,6 +14,7 @@ export default function UserChat() {
   const [mode, setMode] = useState(null);
   const [sessionStatus, setSessionStatus] = useState(null);
   const [assignedAgent, setAssignedAgent] = useState(null);
+  const [queueInfo, setQueueInfo] = useState(null);
   const chatRef = useRef(null);
   const [input, setInput] = useState('');
   const [wsRef, setWsRef] = useState(null);
@@ -37,73 +39,93 @@ export default function UserChat() {
   useEffect(() => {
     if (!sessionId || !userId) return;
     
-    fetch('http://localhost:8080/api/session/info?sessionId=' + sessionId)
+    authFetch('http://localhost:8080/api/session/info?sessionId=' + sessionId)
       .then(res => res.json())
       .then(data => {
         setMode(data.mode);
         setAssignedAgent(data.assignedAgent);
-        setSessionStatus('active');
+        setSessionStatus(data.status === 'waiting_for_agent' ? data.status : 'active');
       })
       .catch(err => {
         console.error('Session info error:', err);
         setSessionStatus('error');
       });
 
-    const ws = new window.WebSocket(`ws://localhost:8080/ws?sessionId=${sessionId}&userId=${userId}`);
-    setWsRef(ws);
-    
-    ws.onmessage = (event) => {
-      const msg = JSON.parse(event.data);
-      console.log('WS message received:', msg);
-      
-      if (msg.sender === 'system' && (msg.mode || msg.status || msg.assignedAgent)) {
-        if (msg.mode) {
-          setMode(msg.mode);
+    const ws = openChatSocket(sessionId, {
+      onFrame: (msg) => {
+        console.log('WS message received:', msg);
       
-          if (msg.mode === 'human' && msg.assignedAgent) {
-            console.log('Agent took over session');
-        
+        if (msg.type === 'session_state') {
+          const state = msg.payload;
+          if (state.mode) {
+            setMode(state.mode);
+            if (state.mode === 'human' && state.assignedAgent) {
+              console.log('Agent took over session:', state.assignedAgent);
+            }
           }
-        }
-        if (msg.status) {
-          setSessionStatus(msg.status);
-      
-          if (msg.status === 'completed') {
-            console.log('Session completed, redirecting to messages page');
-            window.location.href = '/user/messages';
-            return;
+          if (state.status) {
+            setSessionStatus(state.status);
+            if (state.status === 'completed') {
+              console.log('Session completed, redirecting to messages page');
+              window.location.href = '/user/messages';
+              return;
+            }
+          }
+          if (state.assignedAgent) {
+            setAssignedAgent(state.assignedAgent);
+          }
+          if (state.status !== 'waiting_for_agent') {
+            setQueueInfo(null);
           }
+          return;
         }
-        if (msg.assignedAgent) {
-          setAssignedAgent(msg.assignedAgent);
+
+        if (msg.type === 'queue_status') {
+          setQueueInfo(msg.payload);
+          return;
         }
-        if (msg.mode) {
-          setMode(msg.mode);
-          if (msg.mode === 'human' && msg.assignedAgent) {
-            console.log('Agent took over session:', msg.assignedAgent);
-        
-          }
+
+        if (msg.type === 'error') {
+          console.warn('WebSocket error frame:', msg.payload);
+          return;
         }
-        return;
-      }
-      
-      console.log('Adding message to UI:', { sender: msg.sender, text: msg.message });
-      setMessages((prev) => [...prev, { sender: msg.sender, text: msg.message }]);
-    };
 
-    ws.onopen = () => {
-      console.log('WebSocket connected');
-    };
+        if (msg.type === 'ai_delta') {
+          setMessages((prev) => {
+            const i = prev.findIndex((m) => m.id === msg.id);
+            if (i === -1) return [...prev, { id: msg.id, sender: 'system', text: msg.payload.text }];
+            const next = [...prev];
+            next[i] = { ...next[i], text: next[i].text + msg.payload.text };
+            return next;
+          });
+          return;
+        }
 
-    ws.onerror = (error) => {
-      console.error('WebSocket error:', error);
-      setSessionStatus('error');
-    };
+        if (msg.type === 'ai_cancelled') {
+          setMessages((prev) => prev.filter((m) => m.id !== msg.id));
+          return;
+        }
 
-    ws.onclose = () => {
-      console.log('WebSocket disconnected');
-      setSessionStatus('disconnected');
-    };
+        if (msg.type === 'chat_message' || msg.type === 'ai_complete') {
+          const final = { id: msg.id, sender: msg.payload.sender, text: msg.payload.text };
+          setMessages((prev) => {
+            const i = prev.findIndex((m) => m.id === msg.id);
+            if (i === -1) return [...prev, final];
+            const next = [...prev];
+            next[i] = final;
+            return next;
+          });
+        }
+      },
+      onOpen: () => {
+        console.log('WebSocket connected');
+      },
+      onClose: () => {
+        console.log('WebSocket disconnected, reconnecting');
+        setSessionStatus('disconnected');
+      },
+    });
+    setWsRef(ws);
 
     return () => ws && ws.close();
   }, [sessionId, userId]);
@@ -152,16 +174,9 @@ export default function UserChat() {
     
     const messageText = input.trim();
     
-    const message = {
-      sessionId: sessionId,
-      userId: userId,
-      message: messageText,
-      sender: 'user'
-    };
-    
     try {
-      wsRef.send(JSON.stringify(message));
-      console.log('Message sent to WebSocket:', message);
+      wsRef.send(messageText);
+      console.log('Message sent to WebSocket:', messageText);
     } catch (error) {
       console.error('Error sending message:', error);
     }
@@ -177,7 +192,7 @@ export default function UserChat() {
     if (!sessionId) return;
     
     try {
-      const response = await fetch('http://localhost:8080/api/session/end', {
+      const response = await authFetch('http://localhost:8080/api/session/end', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
@@ -212,7 +227,11 @@ export default function UserChat() {
             <div>
               <h1 className="text-lg font-semibold text-card-foreground">Customer Service Chat</h1>
               <p className="text-sm text-muted-foreground">
-                {mode === 'system' ? 'AI Asistan' : assignedAgent ? 'Müşteri Temsilcisi' : 'Bağlanıyor...'}
+                {sessionStatus === 'waiting_for_agent'
+                  ? queueInfo
+                    ? `Sıranız: ${queueInfo.position} · tahmini bekleme ~${Math.max(1, Math.round(queueInfo.estimatedWaitSeconds / 60))} dk`
+                    : 'Temsilci bekleniyor...'
+                  : mode === 'system' ? 'AI Asistan' : assignedAgent ? 'Müşteri Temsilcisi' : 'Bağlanıyor...'}
               </p>
             </div>
           </div>
@@ -1,5 +1,6 @@
 import { useState } from 'react';
 import { Inter } from "next/font/google";
+import { saveTokens } from '../../auth';
 
 const inter = Inter({
   variable: "--font-inter",
@@ -28,6 +29,7 @@ export default function UserLogin() {
       if (res.ok) {
         const userId = form.email;
         localStorage.setItem('userId', userId);
+        saveTokens(data);
         window.location.href = '/user/messages';
       } else {
         alert(data.error || 'Hatalı giriş.');
@@ -1,6 +1,7 @@
 import { useEffect, useState } from 'react';
 import { Inter } from "next/font/google";
 import Link from 'next/link';
+import { authFetch } from '../../auth';
 
 const inter = Inter({
   variable: "--font-inter",
@@ -12,6 +13,8 @@ export default function UserMessages() {
   const [sessions, setSessions] = useState([]);
   const [loading, setLoading] = useState(true);
   const [debug, setDebug] = useState('');
+  const [skill, setSkill] = useState('');
+  const [language, setLanguage] = useState('tr');
 
   useEffect(() => {
     const userId = localStorage.getItem('userId');
@@ -27,7 +30,7 @@ export default function UserMessages() {
     try {
       setLoading(true);
       
-      const activeResponse = await fetch(`http://localhost:8080/api/session/user/active?userId=${userId}`);
+      const activeResponse = await authFetch(`http://localhost:8080/api/session/user/active?userId=${userId}`);
       const activeData = await activeResponse.json();
       
       if (activeData.session) {
@@ -35,7 +38,7 @@ export default function UserMessages() {
         return;
       }
 
-      const response = await fetch(`http://localhost:8080/api/session/user/${userId}`);
+      const response = await authFetch(`http://localhost:8080/api/session/user/${userId}`);
       const data = await response.json();
       
       if (data.sessions) {
@@ -52,13 +55,15 @@ export default function UserMessages() {
 
   const startNewChat = async () => {
     try {
-      const response = await fetch('http://localhost:8080/api/session/start', {
+      const response = await authFetch('http://localhost:8080/api/session/start', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
         },
         body: JSON.stringify({
           userId: userId,
+          skill: skill,
+          language: language,
         }),
       });
 
@@ -117,6 +122,24 @@ export default function UserMessages() {
             </div>
           </div>
           <div className="flex items-center space-x-2">
+            <select
+              className="input h-9 text-sm"
+              value={skill}
+              onChange={(e) => setSkill(e.target.value)}
+            >
+              <option value="">Konu seçin</option>
+              <option value="billing">Fatura / Ödeme</option>
+              <option value="technical">Teknik Destek</option>
+              <option value="returns">İade / Değişim</option>
+            </select>
+            <select
+              className="input h-9 text-sm"
+              value={language}
+              onChange={(e) => setLanguage(e.target.value)}
+            >
+              <option value="tr">Türkçe</option>
+              <option value="en">English</option>
+            </select>
             <button 
               className="btn btn-primary btn-sm"
               onClick={startNewChat}